@@ -323,7 +323,7 @@ func (s *AuthServiceImpl) Login(ctx context.Context, email, password, ip, userAg
 	}
 
 	// Generate tokens
-	accessToken, err := s.generateAccessToken(user.ID)
+	accessToken, err := s.generateAccessToken(ctx, user.ID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate access token: %w", err)
 	}
@@ -476,7 +476,7 @@ func (s *AuthServiceImpl) RefreshToken(ctx context.Context, refreshToken string)
 	}
 
 	// Generate a new access token
-	accessToken, err := s.generateAccessToken(session.UserID)
+	accessToken, err := s.generateAccessToken(ctx, session.UserID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate access token: %w", err)
 	}
@@ -701,8 +701,9 @@ func (s *AuthServiceImpl) RemoveRoleFromUser(ctx context.Context, userID, roleID
 
 // Helper functions
 
-// generateToken generates a JWT token
-func (s *AuthServiceImpl) generateToken(userID string, expiresIn time.Duration) (string, error) {
+// generateToken generates a JWT token. Non-nil permissions are added as the
+// permissions claim.
+func (s *AuthServiceImpl) generateToken(userID string, permissions []string, expiresIn time.Duration) (string, error) {
 	// Create the claims
 	claims := jwt.MapClaims{
 		"sub": userID,
@@ -712,6 +713,9 @@ func (s *AuthServiceImpl) generateToken(userID string, expiresIn time.Duration)
 		"iat": time.Now().Unix(),
 		"jti": uuid.New().String(),
 	}
+	if permissions != nil {
+		claims["permissions"] = permissions
+	}
 
 	// Create the token
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -725,12 +729,24 @@ func (s *AuthServiceImpl) generateToken(userID string, expiresIn time.Duration)
 	return tokenString, nil
 }
 
-// generateAccessToken generates an access token
-func (s *AuthServiceImpl) generateAccessToken(userID string) (string, error) {
-	return s.generateToken(userID, time.Duration(s.config.JWT.AccessTokenTTL)*time.Minute)
+// generateAccessToken generates an access token carrying the user's
+// permissions, so that services can authorize requests without calling
+// ValidateToken
+func (s *AuthServiceImpl) generateAccessToken(ctx context.Context, userID string) (string, error) {
+	permissions, err := s.repo.GetPermissionsByUserID(ctx, userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get permissions: %w", err)
+	}
+
+	permissionStrings := make([]string, len(permissions))
+	for i, permission := range permissions {
+		permissionStrings[i] = permission.Name
+	}
+
+	return s.generateToken(userID, permissionStrings, time.Duration(s.config.JWT.AccessTokenTTL)*time.Minute)
 }
 
 // generateRefreshToken generates a refresh token
 func (s *AuthServiceImpl) generateRefreshToken(userID string) (string, error) {
-	return s.generateToken(userID, time.Duration(s.config.JWT.RefreshTokenTTL)*24*time.Hour)
+	return s.generateToken(userID, nil, time.Duration(s.config.JWT.RefreshTokenTTL)*24*time.Hour)
 }
@@ -0,0 +1,56 @@
+// Command eventschema writes the JSON Schema of every event type registered in
+// events.DefaultRegistry, for consumers that are not written in Go.
+//
+// Usage:
+//
+//	eventschema -out ./schemas
+//
+// Without -out, all schemas are printed to stdout as one JSON object keyed by
+// event type.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/SteinerLabs/lms/backend/shared/events"
+)
+
+func main() {
+	out := flag.String("out", "", "directory to write one <event type>.schema.json file per event type to")
+	flag.Parse()
+
+	schemas := map[string]*events.Schema{
+		"envelope": events.EnvelopeSchema("", nil),
+	}
+	for _, eventType := range events.DefaultRegistry.Types() {
+		schemas[eventType] = events.DefaultRegistry.Schema(eventType)
+	}
+
+	if *out == "" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(schemas); err != nil {
+			log.Fatalf("Failed to write schemas: %v", err)
+		}
+		return
+	}
+
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		log.Fatalf("Failed to create output directory: %v", err)
+	}
+	for name, schema := range schemas {
+		b, err := json.MarshalIndent(schema, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to encode schema of %s: %v", name, err)
+		}
+		path := filepath.Join(*out, name+".schema.json")
+		if err := os.WriteFile(path, append(b, '\n'), 0o644); err != nil {
+			log.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	log.Printf("Wrote %d schemas to %s", len(schemas), *out)
+}
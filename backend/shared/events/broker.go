@@ -0,0 +1,229 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Broker stores published messages and delivers them to durable
+// subscriptions. Publisher and Consumer work on any Broker: JetStream in
+// production, MemoryBroker in tests and local development.
+type Broker interface {
+	// Publish stores msg and returns the stream's acknowledgement
+	Publish(ctx context.Context, msg *nats.Msg) (*nats.PubAck, error)
+
+	// PublishAsync stores msg without waiting for the acknowledgement
+	PublishAsync(msg *nats.Msg) (nats.PubAckFuture, error)
+
+	// Subscribe delivers the messages of cfg.Subject to handler through the
+	// durable cfg.Durable until ctx is cancelled or the subscription ends.
+	// Messages are delivered one at a time, in stream order.
+	Subscribe(ctx context.Context, cfg SubscribeConfig, handler func(Delivery)) (Subscription, error)
+}
+
+// SubscribeConfig describes a durable subscription
+type SubscribeConfig struct {
+	Subject string
+	Durable string
+	Stream  string        // Bind to a durable provisioned in Stream instead of creating it
+	AckWait time.Duration // Redeliver messages not acknowledged within AckWait
+
+	// PullBatch fetches up to PullBatch messages at a time, waiting at most
+	// PullMaxWait for a batch to fill. Zero uses a push subscription.
+	PullBatch   int
+	PullMaxWait time.Duration
+}
+
+// Delivery is a message delivered to a subscription. It must be settled with
+// Ack, Nak or Term, or it is redelivered after the AckWait.
+type Delivery interface {
+	// Msg returns the delivered message
+	Msg() *nats.Msg
+
+	// Metadata returns the stream position and delivery count of the message
+	Metadata() (*nats.MsgMetadata, error)
+
+	// Ack acknowledges the message as processed
+	Ack() error
+
+	// Nak asks for the message to be redelivered after delay
+	Nak(delay time.Duration) error
+
+	// InProgress resets the AckWait of the message
+	InProgress() error
+
+	// Term stops the redelivery of the message without processing it
+	Term() error
+}
+
+// Subscription is a running durable subscription
+type Subscription interface {
+	// Drain stops the delivery of new messages. The returned channel is
+	// closed once the messages already delivered have been handed over.
+	Drain() (<-chan struct{}, error)
+
+	// Unsubscribe stops the delivery of messages immediately
+	Unsubscribe() error
+}
+
+// jetStreamBroker is the Broker backed by NATS JetStream
+type jetStreamBroker struct {
+	js nats.JetStreamContext
+}
+
+// NewJetStreamBroker returns a Broker that publishes to and subscribes
+// through js
+func NewJetStreamBroker(js nats.JetStreamContext) Broker {
+	return &jetStreamBroker{js: js}
+}
+
+// Publish implements Broker
+func (b *jetStreamBroker) Publish(ctx context.Context, msg *nats.Msg) (*nats.PubAck, error) {
+	return b.js.PublishMsg(msg, nats.Context(ctx))
+}
+
+// PublishAsync implements Broker
+func (b *jetStreamBroker) PublishAsync(msg *nats.Msg) (nats.PubAckFuture, error) {
+	return b.js.PublishMsgAsync(msg)
+}
+
+// Subscribe implements Broker. Pull subscriptions are fetched on a goroutine
+// that ends with ctx or the subscription.
+//
+// Unless cfg.Stream is set, the durable is created or updated here and then
+// bound to. Durables that nats.go creates itself are deleted when the
+// subscription is unsubscribed or drained, which would lose their position.
+func (b *jetStreamBroker) Subscribe(ctx context.Context, cfg SubscribeConfig, handler func(Delivery)) (Subscription, error) {
+	stream := cfg.Stream
+	if stream == "" {
+		var err error
+		if stream, err = b.js.StreamNameBySubject(cfg.Subject, nats.Context(ctx)); err != nil {
+			return nil, fmt.Errorf("failed to find stream of %s: %w", cfg.Subject, err)
+		}
+		if err := b.ensureDurable(ctx, stream, cfg); err != nil {
+			return nil, err
+		}
+	}
+	opts := []nats.SubOpt{nats.Bind(stream, cfg.Durable)}
+	deliver := func(msg *nats.Msg) {
+		handler(jetStreamDelivery{msg})
+	}
+
+	if cfg.PullBatch <= 0 {
+		sub, err := b.js.Subscribe(cfg.Subject, deliver, append(opts, nats.ManualAck())...)
+		if err != nil {
+			return nil, err
+		}
+		return jetStreamSubscription{sub}, nil
+	}
+
+	sub, err := b.js.PullSubscribe(cfg.Subject, cfg.Durable, opts...)
+	if err != nil {
+		return nil, err
+	}
+	go fetch(ctx, sub, cfg.PullBatch, cfg.PullMaxWait, deliver)
+	return jetStreamSubscription{sub}, nil
+}
+
+// ensureDurable creates the durable of cfg in stream, or updates its subject
+// and AckWait when they changed
+func (b *jetStreamBroker) ensureDurable(ctx context.Context, stream string, cfg SubscribeConfig) error {
+	consumer := nats.ConsumerConfig{
+		Durable:       cfg.Durable,
+		AckPolicy:     nats.AckExplicitPolicy,
+		DeliverPolicy: nats.DeliverAllPolicy,
+		FilterSubject: cfg.Subject,
+		AckWait:       cfg.AckWait,
+	}
+	if cfg.PullBatch <= 0 {
+		consumer.DeliverSubject = "_deliver." + cfg.Durable
+	}
+
+	info, err := b.js.ConsumerInfo(stream, cfg.Durable, nats.Context(ctx))
+	if errors.Is(err, nats.ErrConsumerNotFound) {
+		if _, err := b.js.AddConsumer(stream, &consumer, nats.Context(ctx)); err != nil {
+			return fmt.Errorf("failed to add consumer %s: %w", cfg.Durable, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get consumer %s: %w", cfg.Durable, err)
+	}
+
+	current := info.Config
+	if current.FilterSubject == consumer.FilterSubject && current.AckWait == consumer.AckWait {
+		return nil
+	}
+	current.FilterSubject, current.AckWait = consumer.FilterSubject, consumer.AckWait
+	if _, err := b.js.UpdateConsumer(stream, &current, nats.Context(ctx)); err != nil {
+		return fmt.Errorf("failed to update consumer %s: %w", cfg.Durable, err)
+	}
+	return nil
+}
+
+// fetch pulls batches from sub until ctx is cancelled or sub is closed
+func fetch(ctx context.Context, sub *nats.Subscription, batch int, maxWait time.Duration, deliver nats.MsgHandler) {
+	for ctx.Err() == nil && sub.IsValid() {
+		fetchCtx, cancel := context.WithTimeout(ctx, maxWait)
+		msgs, err := sub.Fetch(batch, nats.Context(fetchCtx))
+		cancel()
+
+		for _, msg := range msgs {
+			deliver(msg)
+		}
+
+		switch {
+		case err == nil, errors.Is(err, context.DeadlineExceeded), errors.Is(err, nats.ErrTimeout):
+		case errors.Is(err, context.Canceled), errors.Is(err, nats.ErrBadSubscription), errors.Is(err, nats.ErrConnectionClosed):
+			return
+		default:
+			log.Printf("Failed to fetch messages: %v", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(maxWait):
+			}
+		}
+	}
+}
+
+// jetStreamDelivery is a Delivery of a JetStream message
+type jetStreamDelivery struct {
+	msg *nats.Msg
+}
+
+func (d jetStreamDelivery) Msg() *nats.Msg                       { return d.msg }
+func (d jetStreamDelivery) Metadata() (*nats.MsgMetadata, error) { return d.msg.Metadata() }
+func (d jetStreamDelivery) Ack() error                           { return d.msg.Ack() }
+func (d jetStreamDelivery) Nak(delay time.Duration) error        { return d.msg.NakWithDelay(delay) }
+func (d jetStreamDelivery) InProgress() error                    { return d.msg.InProgress() }
+func (d jetStreamDelivery) Term() error                          { return d.msg.Term() }
+
+// jetStreamSubscription is a Subscription to JetStream
+type jetStreamSubscription struct {
+	sub *nats.Subscription
+}
+
+// Drain implements Subscription
+func (s jetStreamSubscription) Drain() (<-chan struct{}, error) {
+	closed := s.sub.StatusChanged(nats.SubscriptionClosed)
+	if err := s.sub.Drain(); err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		<-closed
+		close(done)
+	}()
+	return done, nil
+}
+
+// Unsubscribe implements Subscription
+func (s jetStreamSubscription) Unsubscribe() error {
+	return s.sub.Unsubscribe()
+}
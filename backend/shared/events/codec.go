@@ -0,0 +1,276 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/SteinerLabs/lms/backend/shared/events/eventspb"
+	"github.com/nats-io/nats.go"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ContentTypeHeader is the message header naming the codec of an event.
+// Messages without it are JSON encoded.
+const ContentTypeHeader = "Content-Type"
+
+// Content types of the built-in codecs
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/protobuf"
+)
+
+// Codec encodes events for the wire
+type Codec interface {
+	// ContentType identifies the codec in the ContentTypeHeader
+	ContentType() string
+
+	// Encode encodes event
+	Encode(event Event[any]) ([]byte, error)
+
+	// Decode decodes an event, using r for its payload type and upcasters
+	Decode(r *Registry, data []byte) (Event[any], error)
+}
+
+// defaultCodecs returns the codecs consumers understand by default, keyed by
+// content type
+func defaultCodecs() map[string]Codec {
+	return map[string]Codec{
+		ContentTypeJSON:     JSONCodec{},
+		ContentTypeProtobuf: NewProtoCodec(),
+	}
+}
+
+// codecFor returns the codec named by the content type of msg
+func codecFor(codecs map[string]Codec, msg *nats.Msg) (Codec, error) {
+	contentType := msg.Header.Get(ContentTypeHeader)
+	if contentType == "" {
+		contentType = ContentTypeJSON
+	}
+	codec, ok := codecs[contentType]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported content type %q", ErrDecode, contentType)
+	}
+	return codec, nil
+}
+
+// JSONCodec encodes events as JSON
+type JSONCodec struct{}
+
+// ContentType implements Codec
+func (JSONCodec) ContentType() string {
+	return ContentTypeJSON
+}
+
+// Encode implements Codec
+func (JSONCodec) Encode(event Event[any]) ([]byte, error) {
+	return json.Marshal(event)
+}
+
+// Decode implements Codec
+func (JSONCodec) Decode(r *Registry, data []byte) (Event[any], error) {
+	return r.Decode(data)
+}
+
+// ProtoCodec encodes events as an eventspb.Envelope. Payloads are encoded
+// with the protobuf message registered for their event type; payloads of
+// other event types are carried as JSON inside the envelope.
+type ProtoCodec struct {
+	mu       sync.RWMutex
+	messages map[string]protoreflect.MessageType
+}
+
+// NewProtoCodec creates a codec that knows the messages of every event type
+// declared in this package
+func NewProtoCodec() *ProtoCodec {
+	c := &ProtoCodec{
+		messages: make(map[string]protoreflect.MessageType),
+	}
+	registerProtoMessages(c)
+	return c
+}
+
+// Register associates eventType with the protobuf message its payload is
+// encoded as. Message fields are matched to the json names of the payload
+// struct's fields; payloads with fields the message lacks fail to encode.
+func (c *ProtoCodec) Register(eventType string, msg proto.Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages[eventType] = msg.ProtoReflect().Type()
+}
+
+func (c *ProtoCodec) lookup(eventType string) (protoreflect.MessageType, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	mt, ok := c.messages[eventType]
+	return mt, ok
+}
+
+// ContentType implements Codec
+func (c *ProtoCodec) ContentType() string {
+	return ContentTypeProtobuf
+}
+
+// Encode implements Codec
+func (c *ProtoCodec) Encode(event Event[any]) ([]byte, error) {
+	env := &eventspb.Envelope{
+		Id:            event.ID,
+		TraceId:       event.TraceID,
+		CorrelationId: event.CorrelationID,
+		CausationId:   event.CausationID,
+		Source:        event.Source,
+		TenantId:      event.TenantID,
+		ActorId:       event.ActorID,
+		Type:          event.Type,
+		SchemaVersion: int32(event.SchemaVersion),
+		OccurredAt:    timestamppb.New(event.OccurredAt),
+	}
+
+	if event.Data != nil {
+		data, err := json.Marshal(event.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		mt, ok := c.lookup(event.Type)
+		if !ok {
+			env.JsonData = data
+		} else {
+			msg := mt.New().Interface()
+			if err := protojson.Unmarshal(data, msg); err != nil {
+				return nil, fmt.Errorf("failed to convert %s payload to protobuf: %w", event.Type, err)
+			}
+			if env.Data, err = proto.Marshal(msg); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return proto.Marshal(env)
+}
+
+// Decode implements Codec. The payload is converted to JSON and decoded by r,
+// so upcasters registered for the event type apply as well.
+func (c *ProtoCodec) Decode(r *Registry, data []byte) (Event[any], error) {
+	var env eventspb.Envelope
+	if err := proto.Unmarshal(data, &env); err != nil {
+		return Event[any]{}, fmt.Errorf("%w: envelope: %v", ErrDecode, err)
+	}
+
+	raw := Event[json.RawMessage]{
+		ID:            env.Id,
+		TraceID:       env.TraceId,
+		CorrelationID: env.CorrelationId,
+		CausationID:   env.CausationId,
+		Source:        env.Source,
+		TenantID:      env.TenantId,
+		ActorID:       env.ActorId,
+		Type:          env.Type,
+		SchemaVersion: int(env.SchemaVersion),
+		Data:          env.JsonData,
+	}
+	if env.OccurredAt != nil {
+		raw.OccurredAt = env.OccurredAt.AsTime()
+	}
+
+	if mt, ok := c.lookup(env.Type); ok && len(env.Data) > 0 {
+		msg := mt.New()
+		if err := proto.Unmarshal(env.Data, msg.Interface()); err != nil {
+			return Event[any]{}, fmt.Errorf("%w: %s: %v", ErrDecode, env.Type, err)
+		}
+		b, err := json.Marshal(protoToMap(msg))
+		if err != nil {
+			return Event[any]{}, fmt.Errorf("%w: %s: %v", ErrDecode, env.Type, err)
+		}
+		raw.Data = b
+	}
+	return r.decodeRaw(raw)
+}
+
+// protoToMap converts msg to the generic form of its JSON encoding, keyed by
+// proto field names. Unlike protojson it keeps 64-bit integers as numbers and
+// includes unset fields, matching the JSON encoding of payload structs.
+func protoToMap(msg protoreflect.Message) map[string]any {
+	out := make(map[string]any)
+	fields := msg.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		v := msg.Get(fd)
+
+		switch {
+		case fd.IsList():
+			list := v.List()
+			items := make([]any, list.Len())
+			for j := range items {
+				items[j] = protoScalar(fd, list.Get(j))
+			}
+			out[string(fd.Name())] = items
+		case fd.IsMap():
+			entries := make(map[string]any)
+			v.Map().Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+				entries[k.String()] = protoScalar(fd.MapValue(), v)
+				return true
+			})
+			out[string(fd.Name())] = entries
+		case fd.Kind() == protoreflect.MessageKind && !msg.Has(fd):
+			if isTimestamp(fd) {
+				out[string(fd.Name())] = time.Time{}
+			} else {
+				out[string(fd.Name())] = nil
+			}
+		default:
+			out[string(fd.Name())] = protoScalar(fd, v)
+		}
+	}
+	return out
+}
+
+func protoScalar(fd protoreflect.FieldDescriptor, v protoreflect.Value) any {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		if isTimestamp(fd) {
+			return v.Message().Interface().(*timestamppb.Timestamp).AsTime()
+		}
+		return protoToMap(v.Message())
+	case protoreflect.EnumKind:
+		return int32(v.Enum())
+	}
+	return v.Interface()
+}
+
+func isTimestamp(fd protoreflect.FieldDescriptor) bool {
+	return fd.Message() != nil && fd.Message().FullName() == "google.protobuf.Timestamp"
+}
+
+// registerProtoMessages registers the protobuf message of every payload
+// struct declared in events.go
+func registerProtoMessages(c *ProtoCodec) {
+	c.Register(TypeUserCreated, &eventspb.UserCreated{})
+	c.Register(TypeUserUpdated, &eventspb.UserUpdated{})
+	c.Register(TypeUserDeleted, &eventspb.UserDeleted{})
+	c.Register(TypeUserLoggedIn, &eventspb.UserLoggedIn{})
+	c.Register(TypeUserLoggedOut, &eventspb.UserLoggedOut{})
+
+	c.Register(TypeCourseCreated, &eventspb.CourseCreated{})
+	c.Register(TypeCoursePublished, &eventspb.CoursePublished{})
+	c.Register(TypeCourseUpdated, &eventspb.CourseUpdated{})
+	c.Register(TypeCourseDeleted, &eventspb.CourseDeleted{})
+	c.Register(TypeUserEnrolled, &eventspb.UserEnrolled{})
+	c.Register(TypeEnrollmentCompleted, &eventspb.EnrollmentCompleted{})
+
+	c.Register(TypeProgressUpdated, &eventspb.ProgressUpdated{})
+	c.Register(TypeLessonCompleted, &eventspb.LessonCompleted{})
+	c.Register(TypeQuizCompleted, &eventspb.QuizCompleted{})
+	c.Register(TypeAssignmentSubmitted, &eventspb.AssignmentSubmitted{})
+	c.Register(TypeAchievementEarned, &eventspb.AchievementEarned{})
+
+	c.Register(TypePaymentCompleted, &eventspb.PaymentCompleted{})
+	c.Register(TypePaymentFailed, &eventspb.PaymentFailed{})
+
+	c.Register(TypeNotificationSent, &eventspb.NotificationSent{})
+	c.Register(TypeNotificationDelivered, &eventspb.NotificationDelivered{})
+	c.Register(TypeNotificationRead, &eventspb.NotificationRead{})
+}
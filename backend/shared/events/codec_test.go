@@ -0,0 +1,146 @@
+package events
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestProtoCodec_RoundTrip(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 30, 0, 0, time.UTC)
+	codec := NewProtoCodec()
+
+	tests := []struct {
+		name  string
+		event Event[any]
+	}{
+		{"payment", Event[any]{Type: TypePaymentCompleted, Data: PaymentCompletedEvent{ID: "p1", UserID: "u1", Amount: 4999, Currency: "EUR", CompletedAt: now}}},
+		{"quiz", Event[any]{Type: TypeQuizCompleted, Data: QuizCompletedEvent{UserID: "u1", QuizID: "q1", Score: 7.5, Passed: true, CompletedAt: now}}},
+		{"repeated field", Event[any]{Type: TypeCourseCreated, Data: CourseCreatedEvent{ID: "c1", InstructorIDs: []string{"i1", "i2"}, CreatedAt: now}}},
+		{"unset timestamp", Event[any]{Type: TypeUserDeleted, Data: UserDeletedEvent{ID: "u1"}}},
+		{"unregistered type", Event[any]{Type: "custom.event", Data: map[string]any{"n": float64(1)}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := tt.event
+			event.ID = "e1"
+			event.TraceID = "trace"
+			event.TenantID = "acme"
+			event.ActorID = "u1"
+			event.SchemaVersion = 1
+			event.OccurredAt = now
+
+			data, err := codec.Encode(event)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			got, err := codec.Decode(DefaultRegistry, data)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, event) {
+				t.Errorf("Want %+v, got %+v", event, got)
+			}
+		})
+	}
+}
+
+// TestProtoCodec_AllTypes guards against payload structs drifting from their
+// protobuf messages: every field of every registered type must survive a
+// round trip.
+func TestProtoCodec_AllTypes(t *testing.T) {
+	codec := NewProtoCodec()
+	for _, eventType := range DefaultRegistry.Types() {
+		t.Run(eventType, func(t *testing.T) {
+			typ, _ := DefaultRegistry.Lookup(eventType)
+			data := reflect.New(typ).Elem()
+			fillFields(t, data)
+
+			event := Event[any]{ID: "e1", Type: eventType, SchemaVersion: DefaultRegistry.Version(eventType), Data: data.Interface()}
+			encoded, err := codec.Encode(event)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			got, err := codec.Decode(DefaultRegistry, encoded)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got.Data, event.Data) {
+				t.Errorf("Want %+v, got %+v", event.Data, got.Data)
+			}
+		})
+	}
+}
+
+// fillFields sets every field of the struct v to a non-zero value
+func fillFields(t *testing.T, v reflect.Value) {
+	t.Helper()
+	for i := range v.NumField() {
+		f := v.Field(i)
+		switch {
+		case f.Type() == reflect.TypeFor[time.Time]():
+			f.Set(reflect.ValueOf(time.Date(2025, 3, 1, 12, 30, 0, 0, time.UTC)))
+		case f.Kind() == reflect.String:
+			f.SetString(v.Type().Field(i).Name)
+		case f.Kind() == reflect.Bool:
+			f.SetBool(true)
+		case f.CanInt():
+			f.SetInt(42)
+		case f.CanFloat():
+			f.SetFloat(7.5)
+		case f.Kind() == reflect.Slice && f.Type().Elem().Kind() == reflect.String:
+			f.Set(reflect.ValueOf([]string{"a", "b"}).Convert(f.Type()))
+		case f.Kind() == reflect.Struct:
+			fillFields(t, f)
+		default:
+			t.Fatalf("Cannot fill field %s of type %s", v.Type().Field(i).Name, f.Type())
+		}
+	}
+}
+
+func TestConsumer_DecodesByContentType(t *testing.T) {
+	js := &mockJetStream{
+		messages:  make(chan *nats.Msg, 2),
+		published: make(chan *nats.Msg, 2),
+	}
+
+	// Publish one event per codec and feed them to the consumer
+	for _, codec := range []Codec{JSONCodec{}, NewProtoCodec()} {
+		publisher := NewPublisher(NewJetStreamBroker(js), "test-service", WithPublisherCodec(codec))
+		err := publisher.Publish(context.Background(), Event[any]{Type: TypeUserLoggedOut, Data: UserLoggedOutEvent{ID: "u1", Email: "ada@example.com"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		msg := <-js.published
+		if got := msg.Header.Get(ContentTypeHeader); got != codec.ContentType() {
+			t.Errorf("Want content type %q, got %q", codec.ContentType(), got)
+		}
+		js.messages <- msg
+	}
+
+	consumer := NewConsumer(NewJetStreamBroker(js), TypeUserLoggedOut, "test-durable", WithIdempotencyStore(NewMemoryIdempotencyStore(10)))
+	handled := make(chan UserLoggedOutEvent, 2)
+	err := StartTyped(context.Background(), consumer, func(ctx context.Context, event Event[UserLoggedOutEvent]) error {
+		handled <- event.Data
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer consumer.Stop()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case data := <-handled:
+			if data.Email != "ada@example.com" {
+				t.Errorf("Unexpected payload %+v", data)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected both events to be handled")
+		}
+	}
+}
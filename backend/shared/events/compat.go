@@ -0,0 +1,126 @@
+package events
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// PayloadShape describes the JSON fields of a payload at a schema version.
+// Fields maps dotted JSON field paths to a type description such as "string",
+// "time" or "[]string".
+type PayloadShape struct {
+	Version int               `json:"version"`
+	Fields  map[string]string `json:"fields"`
+}
+
+// Shapes returns the shape of every registered payload type, keyed by event
+// type
+func (r *Registry) Shapes() map[string]PayloadShape {
+	shapes := make(map[string]PayloadShape)
+	for _, eventType := range r.Types() {
+		t, _ := r.Lookup(eventType)
+		fields := make(map[string]string)
+		describeFields(t, "", fields)
+		shapes[eventType] = PayloadShape{
+			Version: r.Version(eventType),
+			Fields:  fields,
+		}
+	}
+	return shapes
+}
+
+// CompareShapes reports the breaking changes from old to current. Removing an
+// event type, or removing or retyping a field without bumping the schema
+// version, is breaking. Added fields are not.
+func CompareShapes(old, current map[string]PayloadShape) []string {
+	var breaking []string
+	for eventType, before := range old {
+		after, ok := current[eventType]
+		if !ok {
+			breaking = append(breaking, fmt.Sprintf("%s: event type removed", eventType))
+			continue
+		}
+		if after.Version < before.Version {
+			breaking = append(breaking, fmt.Sprintf("%s: schema version lowered from %d to %d", eventType, before.Version, after.Version))
+			continue
+		}
+		if after.Version > before.Version {
+			// The change is covered by an upcaster
+			continue
+		}
+
+		for field, typ := range before.Fields {
+			switch got, ok := after.Fields[field]; {
+			case !ok:
+				breaking = append(breaking, fmt.Sprintf("%s: field %s removed without a version bump", eventType, field))
+			case got != typ:
+				breaking = append(breaking, fmt.Sprintf("%s: field %s changed from %s to %s without a version bump", eventType, field, typ, got))
+			}
+		}
+	}
+	slices.Sort(breaking)
+	return breaking
+}
+
+var timeType = reflect.TypeFor[time.Time]()
+
+// describeFields adds the JSON fields of struct type t to fields, flattening
+// nested structs into dotted paths
+func describeFields(t reflect.Type, prefix string, fields map[string]string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == timeType {
+		fields[strings.TrimSuffix(prefix, ".")] = describeType(t)
+		return
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" && f.Anonymous {
+			// Fields of embedded structs are promoted by encoding/json
+			describeFields(f.Type, prefix, fields)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		describeFields(f.Type, prefix+name+".", fields)
+	}
+}
+
+func describeType(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return "time"
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		return "[]" + describeType(t.Elem())
+	case t.Kind() == reflect.Map:
+		return "map[" + describeType(t.Key()) + "]" + describeType(t.Elem())
+	case t.Kind() == reflect.Struct:
+		nested := make(map[string]string)
+		describeFields(t, "", nested)
+		keys := make([]string, 0, len(nested))
+		for k := range nested {
+			keys = append(keys, k+":"+nested[k])
+		}
+		slices.Sort(keys)
+		return "{" + strings.Join(keys, ",") + "}"
+	case t.Kind() == reflect.Interface:
+		return "any"
+	}
+	return t.Kind().String()
+}
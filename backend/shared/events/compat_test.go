@@ -0,0 +1,72 @@
+package events
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"testing"
+)
+
+var updateShapes = flag.Bool("update-shapes", false, "rewrite testdata/payload_shapes.json from the current payload structs")
+
+// TestPayloadCompatibility fails when a payload struct changes in a way that
+// breaks consumers of events already in the streams. Bump the schema version
+// with an upcaster, then run the tests with -update-shapes to accept it.
+func TestPayloadCompatibility(t *testing.T) {
+	const golden = "testdata/payload_shapes.json"
+	current := DefaultRegistry.Shapes()
+
+	if *updateShapes {
+		b, err := json.MarshalIndent(current, "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(golden, append(b, '\n'), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var old map[string]PayloadShape
+	if err := json.Unmarshal(b, &old); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, change := range CompareShapes(old, current) {
+		t.Error(change)
+	}
+}
+
+func TestCompareShapes(t *testing.T) {
+	old := map[string]PayloadShape{
+		"user.created": {Version: 1, Fields: map[string]string{"id": "string", "name": "string"}},
+	}
+
+	tests := []struct {
+		name    string
+		current PayloadShape
+		want    int
+	}{
+		{"unchanged", PayloadShape{Version: 1, Fields: map[string]string{"id": "string", "name": "string"}}, 0},
+		{"field added", PayloadShape{Version: 1, Fields: map[string]string{"id": "string", "name": "string", "email": "string"}}, 0},
+		{"field renamed", PayloadShape{Version: 1, Fields: map[string]string{"id": "string", "full_name": "string"}}, 1},
+		{"field retyped", PayloadShape{Version: 1, Fields: map[string]string{"id": "int", "name": "string"}}, 1},
+		{"renamed with version bump", PayloadShape{Version: 2, Fields: map[string]string{"id": "string", "full_name": "string"}}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CompareShapes(old, map[string]PayloadShape{"user.created": tt.current})
+			if len(got) != tt.want {
+				t.Errorf("Want %d breaking changes, got %v", tt.want, got)
+			}
+		})
+	}
+
+	if got := CompareShapes(old, map[string]PayloadShape{}); len(got) != 1 {
+		t.Errorf("Want removed event type to be breaking, got %v", got)
+	}
+}
@@ -4,76 +4,608 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SteinerLabs/lms/backend/shared/trace"
 	"github.com/nats-io/nats.go"
 	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrConsumerStarted is returned when Start is called on a running consumer
+	ErrConsumerStarted = errors.New("consumer already started")
+
+	// ErrConsumerNotStarted is returned when stopping a consumer that is not running
+	ErrConsumerNotStarted = errors.New("consumer not started")
+
+	// ErrNoTxStore is returned by StartTx when the consumer's idempotency
+	// store cannot take part in a database transaction
+	ErrNoTxStore = errors.New("idempotency store does not support transactions")
 )
 
 type HandlerFunc func(ctx context.Context, event Event[any]) error
 
+// TxHandlerFunc handles an event inside a database transaction. The event is
+// recorded as processed in the same transaction, so the handler's writes and
+// the idempotency record are committed or rolled back together. It requires
+// a TxIdempotencyStore.
+type TxHandlerFunc func(ctx context.Context, tx *sql.Tx, event Event[any]) error
+
+// processFunc processes one decoded event and reports whether it had already
+// been processed before
+type processFunc func(ctx context.Context, event Event[any]) (duplicate bool, err error)
+
 type Consumer struct {
-	js      nats.JetStreamContext
-	db      *sql.DB
-	subject string
-	durable string
+	broker      Broker
+	store       IdempotencyStore
+	subject     string
+	durable     string
+	registry    *Registry
+	maxDeliver  uint64
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+
+	ackWait        time.Duration
+	handlerTimeout time.Duration
+	bindStream     string
+	validate       bool
+	codecs         map[string]Codec
+	tenants        []string
+	metrics        *Metrics
+
+	workers     int
+	key         KeyFunc
+	pullBatch   int
+	pullMaxWait time.Duration
+
+	mu     sync.Mutex
+	active *consumerRun
 }
 
-func NewConsumer(js nats.JetStreamContext, db *sql.DB, subject string, durable string) *Consumer {
-	return &Consumer{
-		js:      js,
-		db:      db,
-		subject: subject,
-		durable: durable,
+// ConsumerOption configures optional Consumer behaviour
+type ConsumerOption func(*Consumer)
+
+// WithRegistry sets the registry used to decode event payloads. It defaults
+// to DefaultRegistry.
+func WithRegistry(r *Registry) ConsumerOption {
+	return func(c *Consumer) {
+		c.registry = r
 	}
 }
 
-func (c *Consumer) Start(handler HandlerFunc) error {
-	_, err := c.js.Subscribe(c.subject, func(msg *nats.Msg) {
-		var e Event[any]
-		if err := json.Unmarshal(msg.Data, &e); err != nil {
-			log.Printf("Failed to unmarshal event: %v", err)
-			err := msg.Nak()
-			if err != nil {
-				log.Printf("Failed to nak message: %v", err)
-			}
+// WithMaxDeliver sets how often a message is delivered before it is moved to
+// the dead-letter subject. It defaults to 5.
+func WithMaxDeliver(n int) ConsumerOption {
+	return func(c *Consumer) {
+		c.maxDeliver = uint64(n)
+	}
+}
+
+// WithBackoff sets the exponential redelivery delay after a failed delivery.
+// It defaults to one second, capped at one minute.
+func WithBackoff(base, max time.Duration) ConsumerOption {
+	return func(c *Consumer) {
+		c.baseBackoff = base
+		c.maxBackoff = max
+	}
+}
+
+// WithAckWait sets the AckWait of the subscription. It defaults to
+// 30 seconds.
+func WithAckWait(d time.Duration) ConsumerOption {
+	return func(c *Consumer) {
+		c.ackWait = d
+	}
+}
+
+// WithHandlerTimeout sets how long a handler may run for a single message. It
+// defaults to the AckWait. When the timeout exceeds the AckWait, the consumer
+// sends InProgress heartbeats so the server does not redeliver the message
+// while the handler is still running.
+func WithHandlerTimeout(d time.Duration) ConsumerOption {
+	return func(c *Consumer) {
+		c.handlerTimeout = d
+	}
+}
+
+// WithBindStream binds to a durable that was provisioned in stream, for
+// example by Topology.Reconcile, instead of creating or updating it on Start
+func WithBindStream(stream string) ConsumerOption {
+	return func(c *Consumer) {
+		c.bindStream = stream
+	}
+}
+
+// WithValidation checks every JSON message against the JSON Schema of its
+// event type before decoding it. Invalid events are dead-lettered without
+// being retried.
+func WithValidation() ConsumerOption {
+	return func(c *Consumer) {
+		c.validate = true
+	}
+}
+
+// WithCodecs adds codecs for decoding messages, replacing the codec of the
+// same content type. JSON and protobuf are understood by default.
+func WithCodecs(codecs ...Codec) ConsumerOption {
+	return func(c *Consumer) {
+		for _, codec := range codecs {
+			c.codecs[codec.ContentType()] = codec
+		}
+	}
+}
+
+// WithTenants only handles events of the given tenants; events of other
+// tenants are acknowledged without being handled. Include "" to also handle
+// events without a tenant.
+func WithTenants(tenants ...string) ConsumerOption {
+	return func(c *Consumer) {
+		c.tenants = tenants
+	}
+}
+
+// WithConcurrency handles messages on the given number of workers. Events
+// with the same key, as returned by key, are handled in order on the same
+// worker; a nil key orders nothing and spreads events by ID.
+//
+// Order is only kept while handlers succeed. A failed event is redelivered
+// after its backoff, and later events with the same key are handled before it.
+func WithConcurrency(workers int, key KeyFunc) ConsumerOption {
+	return func(c *Consumer) {
+		c.workers = workers
+		c.key = key
+	}
+}
+
+// WithPullBatch uses a pull subscription that fetches up to batch messages at
+// a time, waiting at most maxWait for a batch to fill. Combine it with
+// WithConcurrency for high-volume subjects.
+func WithPullBatch(batch int, maxWait time.Duration) ConsumerOption {
+	return func(c *Consumer) {
+		c.pullBatch = batch
+		c.pullMaxWait = maxWait
+	}
+}
+
+// WithIdempotencyStore sets the store used to skip events the consumer has
+// already processed. Without a store every delivery is handled.
+func WithIdempotencyStore(store IdempotencyStore) ConsumerOption {
+	return func(c *Consumer) {
+		c.store = store
+	}
+}
+
+// WithConsumerMetrics reports consumer lag, handler durations, naks,
+// redeliveries, duplicates and dead letters to m. It defaults to
+// DefaultMetrics.
+func WithConsumerMetrics(m *Metrics) ConsumerOption {
+	return func(c *Consumer) {
+		c.metrics = m
+	}
+}
+
+func NewConsumer(broker Broker, subject string, durable string, opts ...ConsumerOption) *Consumer {
+	c := &Consumer{
+		broker:      broker,
+		subject:     subject,
+		durable:     durable,
+		registry:    DefaultRegistry,
+		maxDeliver:  5,
+		baseBackoff: time.Second,
+		maxBackoff:  time.Minute,
+		ackWait:     30 * time.Second,
+		codecs:      defaultCodecs(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.handlerTimeout == 0 {
+		c.handlerTimeout = c.ackWait
+	}
+	if c.metrics == nil {
+		c.metrics = DefaultMetrics()
+	}
+	return c
+}
+
+// Start subscribes to the consumer's subject and runs handler for every
+// message. Handler contexts derive from ctx; cancelling ctx cancels running
+// handlers and stops the subscription.
+func (c *Consumer) Start(ctx context.Context, handler HandlerFunc) error {
+	return c.start(ctx, c.plain(handler))
+}
+
+// StartTx is like Start, but runs handler in a database transaction that also
+// records the event as processed. Concurrent deliveries of the same event
+// block on the idempotency record until the first transaction finishes.
+func (c *Consumer) StartTx(ctx context.Context, handler TxHandlerFunc) error {
+	store, ok := c.store.(TxIdempotencyStore)
+	if !ok {
+		return ErrNoTxStore
+	}
+	return c.start(ctx, c.transactional(store, handler))
+}
+
+func (c *Consumer) start(ctx context.Context, process processFunc) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.active != nil {
+		return ErrConsumerStarted
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	run := &consumerRun{cancel: cancel}
+	if c.workers > 1 {
+		run.pool = newWorkerPool(c.workers, c.workers)
+	}
+
+	deliver := func(msg Delivery) {
+		if !run.enter() {
 			return
 		}
+		defer run.leave()
+		c.receive(ctx, run, msg, process)
+	}
 
-		processed, _ := c.hasProcessed(e.ID)
-		if processed {
-			err := msg.Ack()
-			if err != nil {
-				log.Printf("Failed to ack message: %v", err)
-			}
+	sub, err := c.broker.Subscribe(ctx, SubscribeConfig{
+		Subject:     c.subject,
+		Durable:     c.durable,
+		Stream:      c.bindStream,
+		AckWait:     c.ackWait,
+		PullBatch:   c.pullBatch,
+		PullMaxWait: c.pullMaxWait,
+	}, deliver)
+	if err != nil {
+		cancel()
+		run.wait()
+		return err
+	}
+
+	run.sub = sub
+	c.active = run
+
+	go func() {
+		<-ctx.Done()
+		if err := c.stop(run); err != nil && !errors.Is(err, ErrConsumerNotStarted) {
+			log.Printf("Failed to stop consumer: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Drain stops the delivery of new messages, lets already delivered messages
+// finish and waits for running handlers. If ctx expires first, running
+// handlers are cancelled.
+func (c *Consumer) Drain(ctx context.Context) error {
+	run, err := c.detach(nil)
+	if err != nil {
+		return err
+	}
+	defer run.cancel()
+
+	closed, err := run.sub.Drain()
+	if err != nil {
+		run.cancel()
+		run.wait()
+		return err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		<-closed
+		run.wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		run.cancel()
+		run.wait()
+		return ctx.Err()
+	}
+}
+
+// Stop unsubscribes immediately, cancels running handlers and waits for them
+// to return. Their messages are redelivered after the AckWait.
+func (c *Consumer) Stop() error {
+	return c.stop(nil)
+}
+
+func (c *Consumer) stop(only *consumerRun) error {
+	run, err := c.detach(only)
+	if err != nil {
+		return err
+	}
+
+	run.cancel()
+	err = run.sub.Unsubscribe()
+	run.wait()
+	return err
+}
+
+// detach clears the active run so the consumer can be started again. If only
+// is set, the active run is detached only if it is that run.
+func (c *Consumer) detach(only *consumerRun) (*consumerRun, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.active == nil || (only != nil && c.active != only) {
+		return nil, ErrConsumerNotStarted
+	}
+	run := c.active
+	c.active = nil
+	return run, nil
+}
+
+// consumerRun tracks the subscription and running handlers of one Start
+type consumerRun struct {
+	sub    Subscription
+	cancel context.CancelFunc
+	pool   *workerPool
+
+	mu      sync.Mutex
+	closed  bool
+	running sync.WaitGroup
+}
+
+// enter registers a running handler. It reports false once the run is closed.
+func (r *consumerRun) enter() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return false
+	}
+	r.running.Add(1)
+	return true
+}
+
+func (r *consumerRun) leave() {
+	r.running.Done()
+}
+
+// wait closes the run to new handlers and waits for running and queued ones
+func (r *consumerRun) wait() {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return
+	}
+	r.closed = true
+	r.mu.Unlock()
+
+	r.running.Wait()
+	if r.pool != nil {
+		r.pool.close()
+	}
+}
+
+// receive decodes msg and hands it to the worker owning its key, or handles
+// it directly when the consumer runs without workers
+func (c *Consumer) receive(ctx context.Context, run *consumerRun, delivery Delivery, process processFunc) {
+	if ctx.Err() != nil {
+		// The consumer is stopping; the message is redelivered after the AckWait
+		return
+	}
+
+	msg := delivery.Msg()
+	deliveries := uint64(1)
+	if meta, err := delivery.Metadata(); err == nil {
+		deliveries = meta.NumDelivered
+		c.metrics.consumerLag.WithLabelValues(c.durable).Set(float64(meta.NumPending))
+	}
+	if deliveries > 1 {
+		c.metrics.redeliveries.WithLabelValues(c.durable, typeOf(msg)).Inc()
+	}
+
+	if tenant := msg.Header.Get(TenantHeader); tenant != "" && !c.handlesTenant(tenant) {
+		// Skipped before decoding, so other tenants' data is never read
+		c.skip(delivery)
+		return
+	}
+
+	e, err := c.decode(msg)
+	if err != nil {
+		// Invalid or undecodable payloads will never succeed
+		log.Printf("Rejecting event: %v", err)
+		c.deadLetter(delivery, deliveries, err)
+		return
+	}
+	if !c.handlesTenant(e.TenantID) {
+		c.skip(delivery)
+		return
+	}
+	if e.TraceID == "" {
+		// Events from publishers that only set the traceparent header
+		e.TraceID, _ = trace.ParseTraceparent(msg.Header.Get(trace.TraceparentHeader))
+	}
+
+	if run.pool == nil {
+		c.handle(ctx, delivery, e, deliveries, process)
+		return
+	}
+
+	key := e.ID
+	if c.key != nil {
+		key = c.key(e)
+	}
+	run.pool.submit(key, func() {
+		c.handle(ctx, delivery, e, deliveries, process)
+	})
+}
+
+// handlesTenant reports whether the consumer handles events of tenant
+func (c *Consumer) handlesTenant(tenant string) bool {
+	return c.tenants == nil || slices.Contains(c.tenants, tenant)
+}
+
+// skip acknowledges a message the consumer does not handle
+func (c *Consumer) skip(delivery Delivery) {
+	if err := delivery.Ack(); err != nil {
+		log.Printf("Failed to ack message: %v", err)
+	}
+}
+
+// decode validates and decodes msg with the codec named by its content type
+func (c *Consumer) decode(msg *nats.Msg) (Event[any], error) {
+	codec, err := codecFor(c.codecs, msg)
+	if err != nil {
+		return Event[any]{}, err
+	}
+
+	if c.validate && codec.ContentType() == ContentTypeJSON {
+		if err := c.registry.Validate(msg.Data); err != nil {
+			return Event[any]{}, err
+		}
+	}
+	return codec.Decode(c.registry, msg.Data)
+}
+
+func (c *Consumer) handle(ctx context.Context, delivery Delivery, e Event[any], deliveries uint64, process processFunc) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	start := time.Now()
+	duplicate, err := c.run(WithEventContext(ctx, e), delivery, e, process)
+	c.metrics.handleDuration.WithLabelValues(c.durable, e.Type).Observe(time.Since(start).Seconds())
+	if err != nil {
+		log.Printf("Failed to handle event: %v", err)
+		if deliveries >= c.maxDeliver {
+			c.deadLetter(delivery, deliveries, err)
 			return
 		}
+		c.retry(delivery, deliveries)
+		return
+	}
+	if duplicate {
+		log.Printf("Skipping already processed event %s", e.ID)
+		c.metrics.duplicates.WithLabelValues(c.durable, e.Type).Inc()
+	}
 
-		ctx := WithEventContext(context.Background(), e)
+	err = delivery.Ack()
+	if err != nil {
+		log.Printf("Failed to ack message: %v", err)
+	}
+}
 
-		if err := handler(ctx, e); err != nil {
-			log.Printf("Failed to handle event: %v", err)
-			err := msg.Nak()
-			if err != nil {
-				log.Printf("Failed to nak message: %v", err)
+// run calls process with the handler timeout applied. While it runs longer
+// than the AckWait, InProgress heartbeats keep the message from being
+// redelivered.
+func (c *Consumer) run(ctx context.Context, delivery Delivery, e Event[any], process processFunc) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.handlerTimeout)
+	defer cancel()
+
+	if c.handlerTimeout > c.ackWait {
+		go func() {
+			ticker := time.NewTicker(c.ackWait / 2)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if err := delivery.InProgress(); err != nil {
+						log.Printf("Failed to send in progress: %v", err)
+					}
+				}
 			}
-			return
+		}()
+	}
+
+	return process(ctx, e)
+}
+
+// plain processes events with handler, checking and recording the event in
+// the idempotency store around it
+func (c *Consumer) plain(handler HandlerFunc) processFunc {
+	return func(ctx context.Context, e Event[any]) (bool, error) {
+		if c.store == nil {
+			return false, handler(ctx, e)
 		}
 
-		_ = c.markProcessed(e.ID)
-		err := msg.Ack()
+		processed, err := c.store.Seen(ctx, c.durable, e.ID)
 		if err != nil {
-			log.Printf("Failed to ack message: %v", err)
+			return false, err
 		}
-	}, nats.Durable(c.durable), nats.ManualAck())
-	return err
+		if processed {
+			return true, nil
+		}
+
+		if err := handler(ctx, e); err != nil {
+			return false, err
+		}
+
+		// The handler's side effects already happened, so the message is
+		// acknowledged even if the record cannot be written
+		if err := c.store.Mark(ctx, c.durable, e.ID); err != nil {
+			log.Printf("Failed to mark event processed: %v", err)
+		}
+		return false, nil
+	}
 }
 
-func (c *Consumer) hasProcessed(id string) (bool, error) {
-	var exists bool
-	err := c.db.QueryRow("SELECT EXISTS(SELECT 1 FROM processed_events WHERE event_id = $1)", id).Scan(&exists)
-	return exists, err
+// transactional processes events with handler inside a transaction that
+// first claims the event in the idempotency store
+func (c *Consumer) transactional(store TxIdempotencyStore, handler TxHandlerFunc) processFunc {
+	return func(ctx context.Context, e Event[any]) (bool, error) {
+		tx, err := store.BeginTx(ctx)
+		if err != nil {
+			return false, err
+		}
+		defer tx.Rollback()
+
+		claimed, err := store.Claim(ctx, tx, c.durable, e.ID)
+		if err != nil {
+			return false, err
+		}
+		if !claimed {
+			return true, nil
+		}
+
+		if err := handler(ctx, tx, e); err != nil {
+			return false, err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return false, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return false, nil
+	}
 }
 
-func (c *Consumer) markProcessed(id string) error {
-	_, err := c.db.Exec("INSERT INTO processed_events(event_id) VALUES($1) ON CONFLICT DO NOTHING", id)
-	return err
+// retry asks the broker to redeliver a message after the backoff for
+// deliveries
+func (c *Consumer) retry(delivery Delivery, deliveries uint64) {
+	c.metrics.naks.WithLabelValues(c.durable, typeOf(delivery.Msg())).Inc()
+	err := delivery.Nak(backoff(int(deliveries), c.baseBackoff, c.maxBackoff))
+	if err != nil {
+		log.Printf("Failed to nak message: %v", err)
+	}
+}
+
+// deadLetter moves a message to its dead-letter subject and terminates its
+// redelivery. If the dead letter cannot be published, the message is retried.
+func (c *Consumer) deadLetter(delivery Delivery, deliveries uint64, cause error) {
+	msg := delivery.Msg()
+	payload, err := json.Marshal(newDeadLetter(delivery, c.durable, deliveries, cause))
+	if err == nil {
+		_, err = c.broker.Publish(context.Background(), &nats.Msg{Subject: DeadLetterSubject(msg.Subject), Data: payload})
+	}
+	if err != nil {
+		log.Printf("Failed to dead-letter message: %v", err)
+		c.retry(delivery, deliveries)
+		return
+	}
+
+	c.metrics.deadLetters.WithLabelValues(c.durable, typeOf(msg)).Inc()
+	err = delivery.Term()
+	if err != nil {
+		log.Printf("Failed to term message: %v", err)
+	}
 }
@@ -4,7 +4,11 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"github.com/DATA-DOG/go-sqlmock"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -35,7 +39,7 @@ func TestConsumer_Start(t *testing.T) {
 	db := newMockDB()
 	defer db.Close()
 
-	consumer := NewConsumer(mockJS, db, "test.subject", "test-durable")
+	consumer := NewConsumer(NewJetStreamBroker(mockJS), "test.subject", "test-durable", WithIdempotencyStore(NewPostgresIdempotencyStore(db)))
 
 	// Create a test handler
 	handlerCalled := false
@@ -47,7 +51,7 @@ func TestConsumer_Start(t *testing.T) {
 	// Start the consumer in a goroutine
 	errChan := make(chan error, 1)
 	go func() {
-		errChan <- consumer.Start(handler)
+		errChan <- consumer.Start(context.Background(), handler)
 	}()
 
 	// Create and send a test event
@@ -73,3 +77,217 @@ func TestConsumer_Start(t *testing.T) {
 		t.Error("Expected handler to be called")
 	}
 }
+
+func TestConsumer_DeadLetter(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		wantErr string
+	}{
+		{
+			name:    "handler error at max deliveries",
+			payload: []byte(`{"id":"test-id","type":"test.event"}`),
+			wantErr: "handler failed",
+		},
+		{
+			name:    "undecodable payload",
+			payload: []byte(`not json`),
+			wantErr: "event decode failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockJS := &mockJetStream{
+				messages:  make(chan *nats.Msg, 1),
+				published: make(chan *nats.Msg, 1),
+			}
+
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			mock.ExpectQuery("SELECT EXISTS").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+			consumer := NewConsumer(NewJetStreamBroker(mockJS), "test.subject", "test-durable",
+				WithIdempotencyStore(NewPostgresIdempotencyStore(db)), WithMaxDeliver(1))
+			err = consumer.Start(context.Background(), func(ctx context.Context, event Event[any]) error {
+				return errors.New("handler failed")
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			mockJS.messages <- &nats.Msg{Subject: "test.subject", Data: tt.payload}
+
+			select {
+			case msg := <-mockJS.published:
+				if msg.Subject != "dlq.test.subject" {
+					t.Errorf("Want dead letter on %q, got %q", "dlq.test.subject", msg.Subject)
+				}
+				dl, err := decodeDeadLetter(1, msg.Data)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if !strings.Contains(dl.Error, tt.wantErr) {
+					t.Errorf("Want error containing %q, got %q", tt.wantErr, dl.Error)
+				}
+				if string(dl.Payload) != string(tt.payload) {
+					t.Errorf("Want original payload %q, got %q", tt.payload, dl.Payload)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("Expected message to be dead-lettered")
+			}
+		})
+	}
+}
+
+func TestConsumer_Stop(t *testing.T) {
+	mockJS := &mockJetStream{
+		messages: make(chan *nats.Msg, 1),
+	}
+
+	db := newMockDB()
+	defer db.Close()
+
+	consumer := NewConsumer(NewJetStreamBroker(mockJS), "test.subject", "test-durable", WithIdempotencyStore(NewPostgresIdempotencyStore(db)))
+
+	started := make(chan struct{})
+	var returned atomic.Bool
+	handler := func(ctx context.Context, event Event[any]) error {
+		close(started)
+		<-ctx.Done()
+		returned.Store(true)
+		return ctx.Err()
+	}
+
+	if err := consumer.Start(context.Background(), handler); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := consumer.Start(context.Background(), handler); !errors.Is(err, ErrConsumerStarted) {
+		t.Errorf("Want ErrConsumerStarted, got %v", err)
+	}
+
+	mockJS.messages <- &nats.Msg{Subject: "test.subject", Data: []byte(`{"id":"test-id","type":"test.event"}`)}
+
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("Expected handler to be called")
+	}
+
+	// The mock subscription is not bound to a connection, so only the
+	// handler bookkeeping is checked here
+	_ = consumer.Stop()
+	if !returned.Load() {
+		t.Error("Expected Stop to wait for the running handler")
+	}
+	if err := consumer.Stop(); !errors.Is(err, ErrConsumerNotStarted) {
+		t.Errorf("Want ErrConsumerNotStarted, got %v", err)
+	}
+}
+
+func TestConsumer_StopKeepsDurable(t *testing.T) {
+	mockJS := &mockJetStream{
+		messages: make(chan *nats.Msg),
+	}
+	consumer := NewConsumer(NewJetStreamBroker(mockJS), "test.subject", "test-durable", WithAckWait(time.Minute))
+	handler := func(ctx context.Context, event Event[any]) error { return nil }
+
+	// The mock subscriptions are not bound to a connection, so Stop and Drain
+	// report errors; the durable must survive either way
+	for _, stop := range []func() error{consumer.Stop, func() error { return consumer.Drain(context.Background()) }} {
+		if err := consumer.Start(context.Background(), handler); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		_ = stop()
+
+		if _, err := mockJS.ConsumerInfo("TEST", "test-durable"); err != nil {
+			t.Errorf("Want the durable to exist after stopping, got %v", err)
+		}
+	}
+
+	if len(mockJS.deleted) != 0 {
+		t.Errorf("Want no consumers deleted, got %v", mockJS.deleted)
+	}
+	if got := mockJS.consumers["test-durable"]; got.FilterSubject != "test.subject" || got.AckWait != time.Minute || got.AckPolicy != nats.AckExplicitPolicy {
+		t.Errorf("Unexpected durable config %+v", got)
+	}
+	// The durable is provisioned before subscribing, so the subscriptions bind
+	// to it and nats.go does not delete it as its own on unsubscribe
+	if !slices.Equal(mockJS.boundExisting, []bool{true, true}) {
+		t.Errorf("Want both subscriptions made to an existing durable, got %v", mockJS.boundExisting)
+	}
+}
+
+func TestConsumer_HandlerTimeout(t *testing.T) {
+	mockJS := &mockJetStream{
+		messages: make(chan *nats.Msg, 1),
+	}
+
+	db := newMockDB()
+	defer db.Close()
+
+	consumer := NewConsumer(NewJetStreamBroker(mockJS), "test.subject", "test-durable", WithIdempotencyStore(NewPostgresIdempotencyStore(db)),
+		WithAckWait(20*time.Millisecond), WithHandlerTimeout(50*time.Millisecond))
+
+	deadline := make(chan time.Duration, 1)
+	err := consumer.Start(context.Background(), func(ctx context.Context, event Event[any]) error {
+		d, _ := ctx.Deadline()
+		deadline <- time.Until(d)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer consumer.Stop()
+
+	mockJS.messages <- &nats.Msg{Subject: "test.subject", Data: []byte(`{"id":"test-id","type":"test.event"}`)}
+
+	select {
+	case d := <-deadline:
+		if d <= 0 || d > 50*time.Millisecond {
+			t.Errorf("Want handler deadline within 50ms, got %v", d)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected handler to be called")
+	}
+}
+
+func TestConsumer_Tenants(t *testing.T) {
+	b := NewMemoryBroker()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handled := make(chan Event[any], 10)
+	consumer := NewConsumer(b, "*.course.updated", "acme-worker", WithRegistry(NewRegistry()), WithTenants("acme"))
+	err := consumer.Start(ctx, func(ctx context.Context, event Event[any]) error {
+		handled <- event
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	publisher := NewPublisher(b, "test-service", WithTenantSubjects())
+	for _, tenant := range []string{"globex", "acme"} {
+		if err := publisher.Publish(WithTenantID(ctx, tenant), Event[any]{Type: "course.updated"}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	select {
+	case e := <-handled:
+		if e.TenantID != "acme" {
+			t.Errorf("Want only acme events handled, got %q", e.TenantID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected handler to be called")
+	}
+	select {
+	case e := <-handled:
+		t.Errorf("Unexpected event of tenant %q", e.TenantID)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -1,25 +1,73 @@
 package events
 
-import "context"
+import (
+	"context"
+
+	"github.com/SteinerLabs/lms/backend/shared/trace"
+)
 
 type ctxKey int
 
 const (
 	ctxTraceIDKey ctxKey = iota
 	ctxCorrelationIDKey
-	ctxCausationIDKey
+	ctxEventIDKey
+	ctxTenantIDKey
+	ctxActorIDKey
+	ctxReplayIDKey
 )
 
+// WithEventContext returns a context for handling event. Events published
+// with it share the event's trace and correlation IDs, tenant and actor, and
+// name the event as their cause.
 func WithEventContext(ctx context.Context, event Event[any]) context.Context {
 	ctx = context.WithValue(ctx, ctxTraceIDKey, event.TraceID)
 	ctx = context.WithValue(ctx, ctxCorrelationIDKey, event.CorrelationID)
-	ctx = context.WithValue(ctx, ctxCausationIDKey, event.CausationID)
+	ctx = context.WithValue(ctx, ctxEventIDKey, event.ID)
+	ctx = context.WithValue(ctx, ctxTenantIDKey, event.TenantID)
+	ctx = context.WithValue(ctx, ctxActorIDKey, event.ActorID)
 	return ctx
 }
 
+// TraceIDFromContext returns the trace ID of the event being handled, or of
+// the web request when called from an HTTP handler
 func TraceIDFromContext(ctx context.Context) string {
-	if v := ctx.Value(ctxTraceIDKey); v != nil {
-		return v.(string)
+	if v := stringFromContext(ctx, ctxTraceIDKey); v != "" {
+		return v
 	}
-	return ""
+	return trace.TraceIDFromContext(ctx)
+}
+
+func stringFromContext(ctx context.Context, key ctxKey) string {
+	v, _ := ctx.Value(key).(string)
+	return v
+}
+
+// WithCorrelationID returns a context whose published events belong to the
+// flow identified by correlationID, for example a saga
+func WithCorrelationID(ctx context.Context, correlationID string) context.Context {
+	return context.WithValue(ctx, ctxCorrelationIDKey, correlationID)
+}
+
+// WithTenantID returns a context whose published events belong to tenantID
+func WithTenantID(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, ctxTenantIDKey, tenantID)
+}
+
+// TenantIDFromContext returns the tenant set by WithTenantID or of the event
+// being handled
+func TenantIDFromContext(ctx context.Context) string {
+	return stringFromContext(ctx, ctxTenantIDKey)
+}
+
+// WithActorID returns a context whose published events name actorID as their
+// actor
+func WithActorID(ctx context.Context, actorID string) context.Context {
+	return context.WithValue(ctx, ctxActorIDKey, actorID)
+}
+
+// ActorIDFromContext returns the actor set by WithActorID or of the event
+// being handled
+func ActorIDFromContext(ctx context.Context) string {
+	return stringFromContext(ctx, ctxActorIDKey)
 }
@@ -7,6 +7,7 @@ import (
 
 func TestEventContext(t *testing.T) {
 	event := Event[any]{
+		ID:            "event123",
 		TraceID:       "trace123",
 		CorrelationID: "corr123",
 		CausationID:   "cause123",
@@ -37,15 +38,16 @@ func TestEventContext(t *testing.T) {
 			want: "corr123",
 		},
 		{
-			name: "CausationID",
+			// Events published while handling name the event as their cause
+			name: "EventID",
 			getValue: func(ctx context.Context) string {
-				v := ctx.Value(ctxCausationIDKey)
+				v := ctx.Value(ctxEventIDKey)
 				if v == nil {
 					return ""
 				}
 				return v.(string)
 			},
-			want: "cause123",
+			want: "event123",
 		},
 	}
 
@@ -0,0 +1,169 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// DeadLetterStream is the JetStream stream holding dead-lettered events
+	DeadLetterStream = "DLQ"
+
+	// DeadLetterPrefix is prepended to the original subject of a dead letter
+	DeadLetterPrefix = "dlq."
+)
+
+// DeadLetter is a message that could not be processed by a consumer. It keeps
+// the original payload and headers so that it can be replayed unchanged.
+type DeadLetter struct {
+	Sequence   uint64      `json:"-"` // Sequence in the DLQ stream
+	Subject    string      `json:"subject"`
+	Stream     string      `json:"stream"`
+	StreamSeq  uint64      `json:"stream_seq"`
+	Consumer   string      `json:"consumer"`
+	Deliveries uint64      `json:"deliveries"`
+	Error      string      `json:"error"`
+	FailedAt   time.Time   `json:"failed_at"`
+	Header     nats.Header `json:"header,omitempty"`
+	Payload    []byte      `json:"payload"`
+}
+
+// DeadLetterSubject returns the dead-letter subject for subject
+func DeadLetterSubject(subject string) string {
+	return DeadLetterPrefix + subject
+}
+
+// newDeadLetter builds a dead letter for a delivery that failed with cause
+func newDeadLetter(delivery Delivery, durable string, deliveries uint64, cause error) DeadLetter {
+	msg := delivery.Msg()
+	dl := DeadLetter{
+		Subject:    msg.Subject,
+		Consumer:   durable,
+		Deliveries: deliveries,
+		Error:      cause.Error(),
+		FailedAt:   time.Now().UTC(),
+		Header:     msg.Header,
+		Payload:    msg.Data,
+	}
+	if meta, err := delivery.Metadata(); err == nil {
+		dl.Stream = meta.Stream
+		dl.StreamSeq = meta.Sequence.Stream
+	}
+	return dl
+}
+
+// DeadLetterQueue lists, inspects and replays dead-lettered events
+type DeadLetterQueue struct {
+	js     nats.JetStreamContext
+	stream string
+}
+
+// NewDeadLetterQueue creates a DeadLetterQueue on DeadLetterStream
+func NewDeadLetterQueue(js nats.JetStreamContext) *DeadLetterQueue {
+	return &DeadLetterQueue{
+		js:     js,
+		stream: DeadLetterStream,
+	}
+}
+
+// List returns up to limit dead letters for the original subject, oldest
+// first. An empty subject lists dead letters of all subjects.
+func (q *DeadLetterQueue) List(ctx context.Context, subject string, limit int) ([]DeadLetter, error) {
+	filter := DeadLetterPrefix + ">"
+	if subject != "" {
+		filter = DeadLetterSubject(subject)
+	}
+
+	sub, err := q.js.SubscribeSync(filter, nats.BindStream(q.stream), nats.OrderedConsumer(), nats.DeliverAll())
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to dead letters: %w", err)
+	}
+	defer sub.Unsubscribe()
+
+	var letters []DeadLetter
+	for limit <= 0 || len(letters) < limit {
+		fetchCtx, cancel := context.WithTimeout(ctx, time.Second)
+		msg, err := sub.NextMsgWithContext(fetchCtx)
+		cancel()
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			// Nothing left in the stream
+			break
+		}
+		if err != nil {
+			return letters, fmt.Errorf("failed to read dead letter: %w", err)
+		}
+
+		meta, err := msg.Metadata()
+		if err != nil {
+			return letters, fmt.Errorf("failed to read dead letter metadata: %w", err)
+		}
+		dl, err := decodeDeadLetter(meta.Sequence.Stream, msg.Data)
+		if err != nil {
+			return letters, err
+		}
+		letters = append(letters, dl)
+
+		if meta.NumPending == 0 {
+			break
+		}
+	}
+	return letters, nil
+}
+
+// Get returns the dead letter stored at seq
+func (q *DeadLetterQueue) Get(ctx context.Context, seq uint64) (*DeadLetter, error) {
+	raw, err := q.js.GetMsg(q.stream, seq, nats.Context(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dead letter %d: %w", seq, err)
+	}
+	dl, err := decodeDeadLetter(raw.Sequence, raw.Data)
+	if err != nil {
+		return nil, err
+	}
+	return &dl, nil
+}
+
+// Replay republishes the original message of the dead letter at seq to its
+// original subject and removes it from the queue. The message ID and publish
+// expectations are dropped so the stream does not reject the replay as a
+// duplicate.
+func (q *DeadLetterQueue) Replay(ctx context.Context, seq uint64) error {
+	dl, err := q.Get(ctx, seq)
+	if err != nil {
+		return err
+	}
+	dl.Header.Del(nats.MsgIdHdr)
+	dl.Header.Del(nats.ExpectedLastSubjSeqHdr)
+
+	msg := &nats.Msg{
+		Subject: dl.Subject,
+		Header:  dl.Header,
+		Data:    dl.Payload,
+	}
+	if _, err := q.js.PublishMsg(msg, nats.Context(ctx)); err != nil {
+		return fmt.Errorf("failed to replay dead letter %d: %w", seq, err)
+	}
+	return q.Delete(ctx, seq)
+}
+
+// Delete removes the dead letter at seq
+func (q *DeadLetterQueue) Delete(ctx context.Context, seq uint64) error {
+	if err := q.js.DeleteMsg(q.stream, seq, nats.Context(ctx)); err != nil {
+		return fmt.Errorf("failed to delete dead letter %d: %w", seq, err)
+	}
+	return nil
+}
+
+func decodeDeadLetter(seq uint64, data []byte) (DeadLetter, error) {
+	var dl DeadLetter
+	if err := json.Unmarshal(data, &dl); err != nil {
+		return dl, fmt.Errorf("failed to decode dead letter %d: %w", seq, err)
+	}
+	dl.Sequence = seq
+	return dl, nil
+}
@@ -0,0 +1,83 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+)
+
+// dlqJetStream implements the stream operations used by DeadLetterQueue
+type dlqJetStream struct {
+	nats.JetStreamContext
+	stored    map[uint64]*nats.RawStreamMsg
+	published []*nats.Msg
+}
+
+func (m *dlqJetStream) GetMsg(name string, seq uint64, opts ...nats.JSOpt) (*nats.RawStreamMsg, error) {
+	msg, ok := m.stored[seq]
+	if !ok {
+		return nil, nats.ErrMsgNotFound
+	}
+	return msg, nil
+}
+
+func (m *dlqJetStream) DeleteMsg(name string, seq uint64, opts ...nats.JSOpt) error {
+	if _, ok := m.stored[seq]; !ok {
+		return nats.ErrMsgNotFound
+	}
+	delete(m.stored, seq)
+	return nil
+}
+
+func (m *dlqJetStream) PublishMsg(msg *nats.Msg, opts ...nats.PubOpt) (*nats.PubAck, error) {
+	m.published = append(m.published, msg)
+	return &nats.PubAck{}, nil
+}
+
+func TestDeadLetterQueue_Replay(t *testing.T) {
+	dl := DeadLetter{
+		Subject:    "user.created",
+		Consumer:   "user-service",
+		Deliveries: 5,
+		Error:      "handler failed",
+		Header:     nats.Header{"X-Test": []string{"1"}, nats.MsgIdHdr: []string{"e1"}},
+		Payload:    []byte(`{"id":"e1"}`),
+	}
+	data, _ := json.Marshal(dl)
+
+	js := &dlqJetStream{
+		stored: map[uint64]*nats.RawStreamMsg{
+			7: {Subject: DeadLetterSubject(dl.Subject), Sequence: 7, Data: data},
+		},
+	}
+	queue := NewDeadLetterQueue(js)
+	ctx := context.Background()
+
+	got, err := queue.Get(ctx, 7)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got.Sequence != 7 || got.Error != dl.Error || got.Deliveries != dl.Deliveries {
+		t.Errorf("Unexpected dead letter %+v", got)
+	}
+
+	if err := queue.Replay(ctx, 7); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(js.published) != 1 {
+		t.Fatalf("Want 1 replayed message, got %d", len(js.published))
+	}
+	replayed := js.published[0]
+	if replayed.Subject != "user.created" || string(replayed.Data) != `{"id":"e1"}` || replayed.Header.Get("X-Test") != "1" {
+		t.Errorf("Unexpected replayed message %+v", replayed)
+	}
+	if replayed.Header.Get(nats.MsgIdHdr) != "" {
+		t.Error("Expected message ID to be dropped from the replay")
+	}
+	if _, ok := js.stored[7]; ok {
+		t.Error("Expected dead letter to be deleted after replay")
+	}
+}
@@ -12,8 +12,11 @@ type Event[T any] struct {
 	TraceID       string    `json:"trace_id"`
 	CorrelationID string    `json:"correlation_id"`
 	CausationID   string    `json:"causation_id"`
-	Source        string    `json:"source"` // Example: auth-service
+	Source        string    `json:"source"`              // Example: auth-service
+	TenantID      string    `json:"tenant_id,omitempty"` // Organization the event belongs to
+	ActorID       string    `json:"actor_id,omitempty"`  // User or service that caused the event
 	Type          string    `json:"type"`
+	SchemaVersion int       `json:"schema_version,omitempty"` // Version of the Data schema, see RegisterUpcaster
 	OccurredAt    time.Time `json:"occurred_at"`
 	Data          T         `json:"data"`
 }
@@ -42,6 +45,64 @@ func NewEvent[T any](eventType string, source string, data T, correlationID, cau
 	}
 }
 
+// Event types
+const (
+	TypeUserCreated   = "user.created"
+	TypeUserUpdated   = "user.updated"
+	TypeUserDeleted   = "user.deleted"
+	TypeUserLoggedIn  = "user.login"
+	TypeUserLoggedOut = "user.logout"
+
+	TypeCourseCreated       = "course.created"
+	TypeCoursePublished     = "course.published"
+	TypeCourseUpdated       = "course.updated"
+	TypeCourseDeleted       = "course.deleted"
+	TypeUserEnrolled        = "course.enrollment.created"
+	TypeEnrollmentCompleted = "course.enrollment.completed"
+
+	TypeProgressUpdated     = "progress.updated"
+	TypeLessonCompleted     = "progress.lesson.completed"
+	TypeQuizCompleted       = "progress.quiz.completed"
+	TypeAssignmentSubmitted = "progress.assignment.submitted"
+	TypeAchievementEarned   = "progress.achievement.earned"
+
+	TypePaymentCompleted = "billing.payment.completed"
+	TypePaymentFailed    = "billing.payment.failed"
+
+	TypeNotificationSent      = "notification.sent"
+	TypeNotificationDelivered = "notification.delivered"
+	TypeNotificationRead      = "notification.read"
+)
+
+// registerPayloads registers every payload struct declared in this file
+func registerPayloads(r *Registry) {
+	Register[UserCreatedEvent](r, TypeUserCreated)
+	Register[UserUpdatedEvent](r, TypeUserUpdated)
+	Register[UserDeletedEvent](r, TypeUserDeleted)
+	Register[UserLoggedInEvent](r, TypeUserLoggedIn)
+	Register[UserLoggedOutEvent](r, TypeUserLoggedOut)
+
+	Register[CourseCreatedEvent](r, TypeCourseCreated)
+	Register[CoursePublishedEvent](r, TypeCoursePublished)
+	Register[CourseUpdatedEvent](r, TypeCourseUpdated)
+	Register[CourseDeletedEvent](r, TypeCourseDeleted)
+	Register[UserEnrolledEvent](r, TypeUserEnrolled)
+	Register[EnrollmentCompletedEvent](r, TypeEnrollmentCompleted)
+
+	Register[ProgressUpdatedEvent](r, TypeProgressUpdated)
+	Register[LessonCompletedEvent](r, TypeLessonCompleted)
+	Register[QuizCompletedEvent](r, TypeQuizCompleted)
+	Register[AssignmentSubmittedEvent](r, TypeAssignmentSubmitted)
+	Register[AchievementEarnedEvent](r, TypeAchievementEarned)
+
+	Register[PaymentCompletedEvent](r, TypePaymentCompleted)
+	Register[PaymentFailedEvent](r, TypePaymentFailed)
+
+	Register[NotificationSentEvent](r, TypeNotificationSent)
+	Register[NotificationDeliveredEvent](r, TypeNotificationDelivered)
+	Register[NotificationReadEvent](r, TypeNotificationRead)
+}
+
 // User Events
 
 // UserCreatedEvent represents a user.created event
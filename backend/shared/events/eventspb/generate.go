@@ -0,0 +1,5 @@
+// Package eventspb holds the protobuf encoding of events.Event and of the
+// payload structs declared in the events package.
+package eventspb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative events.proto
@@ -0,0 +1,255 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// eventStoreLockID is the Postgres advisory lock that serialises appends, so
+// that positions in the global log become visible in order
+const eventStoreLockID int64 = 0x65767374
+
+// Expected versions with a special meaning for EventStore.Append
+const (
+	AnyVersion = -1 // Append whatever the current version of the stream is
+	NoStream   = 0  // The stream must not exist yet
+)
+
+// ErrWrongExpectedVersion is returned by Append when the stream was changed
+// since the caller read it
+var ErrWrongExpectedVersion = errors.New("wrong expected version")
+
+// RecordedEvent is an event stored in an aggregate stream
+type RecordedEvent struct {
+	Position   int64  // Position in the global log
+	StreamID   string // Aggregate stream, for example course-progress-<user>-<course>
+	Version    int    // Version of the stream after this event; the first event is version 1
+	Event      Event[any]
+	RecordedAt time.Time
+}
+
+// EventStore keeps the events of event-sourced aggregates in the event_store
+// table. Every aggregate has its own stream of versioned events; all streams
+// together form a global log ordered by position.
+type EventStore struct {
+	db       *sql.DB
+	source   string
+	registry *Registry
+	interval time.Duration
+	limit    int
+}
+
+// EventStoreOption configures optional EventStore behaviour
+type EventStoreOption func(*EventStore)
+
+// WithEventStoreRegistry sets the registry used to decode stored events. It
+// defaults to DefaultRegistry.
+func WithEventStoreRegistry(r *Registry) EventStoreOption {
+	return func(s *EventStore) {
+		s.registry = r
+	}
+}
+
+// WithEventStorePollInterval sets how often Subscribe polls the global log
+// once it has caught up. It defaults to one second.
+func WithEventStorePollInterval(d time.Duration) EventStoreOption {
+	return func(s *EventStore) {
+		s.interval = d
+	}
+}
+
+// NewEventStore creates an event store on db. Appended events are enriched
+// like published events, naming source as their source. The tables are
+// created by Migrate.
+func NewEventStore(db *sql.DB, source string, opts ...EventStoreOption) *EventStore {
+	s := &EventStore{
+		db:       db,
+		source:   source,
+		registry: DefaultRegistry,
+		interval: time.Second,
+		limit:    100,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Append appends events to streamID and returns the new version of the
+// stream. It fails with ErrWrongExpectedVersion unless the stream is at
+// expectedVersion; use NoStream for a new stream and AnyVersion to skip the
+// check. Appends are serialised across all streams.
+func (s *EventStore) Append(ctx context.Context, streamID string, expectedVersion int, events ...Event[any]) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", eventStoreLockID); err != nil {
+		return 0, fmt.Errorf("failed to acquire event store lock: %w", err)
+	}
+
+	var version int
+	query := `SELECT COALESCE(MAX(version), 0) FROM event_store WHERE stream_id = $1`
+	if err := tx.QueryRowContext(ctx, query, streamID).Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read stream version: %w", err)
+	}
+	if expectedVersion != AnyVersion && version != expectedVersion {
+		return version, fmt.Errorf("%w: stream %s is at version %d, expected %d", ErrWrongExpectedVersion, streamID, version, expectedVersion)
+	}
+
+	for _, event := range events {
+		enrich(ctx, &event, s.source, s.registry)
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal event: %w", err)
+		}
+
+		version++
+		query := `INSERT INTO event_store (stream_id, version, event_id, event_type, payload) VALUES ($1, $2, $3, $4, $5)`
+		if _, err := tx.ExecContext(ctx, query, streamID, version, event.ID, event.Type, payload); err != nil {
+			return 0, fmt.Errorf("failed to append event: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return version, nil
+}
+
+// Load returns the events of streamID after version afterVersion, oldest
+// first. Use 0 to load the whole stream.
+func (s *EventStore) Load(ctx context.Context, streamID string, afterVersion int) ([]RecordedEvent, error) {
+	query := `SELECT position, stream_id, version, payload, recorded_at FROM event_store
+		WHERE stream_id = $1 AND version > $2
+		ORDER BY version`
+	return s.query(ctx, query, streamID, afterVersion)
+}
+
+// ReadAll returns up to limit events of the global log after position
+// afterPosition, in order
+func (s *EventStore) ReadAll(ctx context.Context, afterPosition int64, limit int) ([]RecordedEvent, error) {
+	query := `SELECT position, stream_id, version, payload, recorded_at FROM event_store
+		WHERE position > $1
+		ORDER BY position LIMIT $2`
+	return s.query(ctx, query, afterPosition, limit)
+}
+
+// Subscribe passes the events of the global log after afterPosition to
+// handler in order, and keeps polling for new events until ctx is cancelled
+// or handler fails. Callers persist the position of the last handled event
+// to resume from it.
+func (s *EventStore) Subscribe(ctx context.Context, afterPosition int64, handler func(ctx context.Context, event RecordedEvent) error) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		events, err := s.ReadAll(ctx, afterPosition, s.limit)
+		if err != nil {
+			return err
+		}
+		for _, e := range events {
+			if err := handler(WithEventContext(ctx, e.Event), e); err != nil {
+				return fmt.Errorf("failed to handle event at position %d: %w", e.Position, err)
+			}
+			afterPosition = e.Position
+		}
+		if len(events) == s.limit {
+			// More events are likely waiting
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *EventStore) query(ctx context.Context, query string, args ...any) ([]RecordedEvent, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query event store: %w", err)
+	}
+	defer rows.Close()
+
+	var events []RecordedEvent
+	for rows.Next() {
+		var e RecordedEvent
+		var payload []byte
+		if err := rows.Scan(&e.Position, &e.StreamID, &e.Version, &payload, &e.RecordedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan event: %w", err)
+		}
+		if e.Event, err = s.registry.Decode(payload); err != nil {
+			return nil, fmt.Errorf("failed to decode event at position %d: %w", e.Position, err)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// SaveSnapshot stores state as the snapshot of streamID at version. An older
+// snapshot is replaced; a newer one is kept.
+func (s *EventStore) SaveSnapshot(ctx context.Context, streamID string, version int, state any) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshot: %w", err)
+	}
+
+	query := `INSERT INTO event_store_snapshots (stream_id, version, state) VALUES ($1, $2, $3)
+		ON CONFLICT (stream_id) DO UPDATE SET version = EXCLUDED.version, state = EXCLUDED.state, taken_at = NOW()
+		WHERE event_store_snapshots.version < EXCLUDED.version`
+	if _, err := s.db.ExecContext(ctx, query, streamID, version, data); err != nil {
+		return fmt.Errorf("failed to save snapshot: %w", err)
+	}
+	return nil
+}
+
+// LoadSnapshot decodes the latest snapshot of streamID into state and returns
+// its version, or 0 if the stream has no snapshot
+func (s *EventStore) LoadSnapshot(ctx context.Context, streamID string, state any) (int, error) {
+	var version int
+	var data []byte
+	query := `SELECT version, state FROM event_store_snapshots WHERE stream_id = $1`
+	err := s.db.QueryRowContext(ctx, query, streamID).Scan(&version, &data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to load snapshot: %w", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return 0, fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+	return version, nil
+}
+
+// LoadAggregate rebuilds the state of the aggregate in streamID from its
+// latest snapshot and the events after it, and returns the state with the
+// stream version to pass to Append
+func LoadAggregate[T any](ctx context.Context, s *EventStore, streamID string, apply func(state *T, event Event[any]) error) (T, int, error) {
+	var state T
+	version, err := s.LoadSnapshot(ctx, streamID, &state)
+	if err != nil {
+		return state, 0, err
+	}
+
+	events, err := s.Load(ctx, streamID, version)
+	if err != nil {
+		return state, 0, err
+	}
+	for _, e := range events {
+		if err := apply(&state, e.Event); err != nil {
+			return state, 0, fmt.Errorf("failed to apply event %d of stream %s: %w", e.Version, streamID, err)
+		}
+		version = e.Version
+	}
+	return state, version, nil
+}
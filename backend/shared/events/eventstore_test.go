@@ -0,0 +1,142 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var eventStoreColumns = []string{"position", "stream_id", "version", "payload", "recorded_at"}
+
+func lessonCompleted(id, lessonID string) []byte {
+	payload, _ := json.Marshal(Event[any]{ID: id, Type: TypeLessonCompleted, Data: LessonCompletedEvent{UserID: "u1", CourseID: "c1", LessonID: lessonID}})
+	return payload
+}
+
+func TestEventStore_Append(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("SELECT pg_advisory_xact_lock").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT COALESCE\\(MAX\\(version\\), 0\\) FROM event_store").WithArgs("progress-u1-c1").
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+	mock.ExpectExec("INSERT INTO event_store").WithArgs("progress-u1-c1", 3, "e3", TypeLessonCompleted, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(3, 1))
+	mock.ExpectExec("INSERT INTO event_store").WithArgs("progress-u1-c1", 4, "e4", TypeLessonCompleted, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(4, 1))
+	mock.ExpectCommit()
+
+	// A writer that read the stream at an older version is rejected
+	mock.ExpectBegin()
+	mock.ExpectExec("SELECT pg_advisory_xact_lock").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT COALESCE\\(MAX\\(version\\), 0\\) FROM event_store").WithArgs("progress-u1-c1").
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(4))
+	mock.ExpectRollback()
+
+	store := NewEventStore(db, "progress-service")
+	version, err := store.Append(context.Background(), "progress-u1-c1", 2,
+		Event[any]{ID: "e3", Type: TypeLessonCompleted, Data: LessonCompletedEvent{LessonID: "l3"}},
+		Event[any]{ID: "e4", Type: TypeLessonCompleted, Data: LessonCompletedEvent{LessonID: "l4"}},
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if version != 4 {
+		t.Errorf("Want version 4, got %d", version)
+	}
+
+	version, err = store.Append(context.Background(), "progress-u1-c1", 2, Event[any]{ID: "e5", Type: TypeLessonCompleted})
+	if !errors.Is(err, ErrWrongExpectedVersion) {
+		t.Errorf("Want ErrWrongExpectedVersion, got %v", err)
+	}
+	if version != 4 {
+		t.Errorf("Want current version 4, got %d", version)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLoadAggregate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery("SELECT version, state FROM event_store_snapshots").WithArgs("progress-u1-c1").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "state"}).AddRow(1, []byte(`{"lessons":["l1"]}`)))
+	mock.ExpectQuery("SELECT (.+) FROM event_store").WithArgs("progress-u1-c1", 1).
+		WillReturnRows(sqlmock.NewRows(eventStoreColumns).
+			AddRow(7, "progress-u1-c1", 2, lessonCompleted("e2", "l2"), now).
+			AddRow(9, "progress-u1-c1", 3, lessonCompleted("e3", "l3"), now))
+
+	type courseProgress struct {
+		Lessons []string `json:"lessons"`
+	}
+	store := NewEventStore(db, "progress-service")
+	state, version, err := LoadAggregate(context.Background(), store, "progress-u1-c1", func(state *courseProgress, event Event[any]) error {
+		completed := event.Data.(LessonCompletedEvent)
+		state.Lessons = append(state.Lessons, completed.LessonID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if version != 3 || len(state.Lessons) != 3 || state.Lessons[2] != "l3" {
+		t.Errorf("Want lessons l1 to l3 at version 3, got %v at version %d", state.Lessons, version)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEventStore_Subscribe(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery("SELECT (.+) FROM event_store").WithArgs(int64(5), 2).
+		WillReturnRows(sqlmock.NewRows(eventStoreColumns).
+			AddRow(6, "progress-u1-c1", 1, lessonCompleted("e1", "l1"), now).
+			AddRow(8, "progress-u2-c1", 1, lessonCompleted("e2", "l1"), now))
+	mock.ExpectQuery("SELECT (.+) FROM event_store").WithArgs(int64(8), 2).
+		WillReturnRows(sqlmock.NewRows(eventStoreColumns).
+			AddRow(9, "progress-u1-c1", 2, lessonCompleted("e3", "l2"), now))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var positions []int64
+	store := NewEventStore(db, "progress-service", WithEventStorePollInterval(time.Hour))
+	store.limit = 2
+	err = store.Subscribe(ctx, 5, func(ctx context.Context, event RecordedEvent) error {
+		positions = append(positions, event.Position)
+		if event.Position == 9 {
+			cancel()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Want context.Canceled, got %v", err)
+	}
+	if !slices.Equal(positions, []int64{6, 8, 9}) {
+		t.Errorf("Want positions 6, 8 and 9, got %v", positions)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
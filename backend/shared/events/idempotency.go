@@ -0,0 +1,211 @@
+package events
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// IdempotencyStore records which events a consumer has already processed
+type IdempotencyStore interface {
+	// Seen reports whether consumer already processed eventID
+	Seen(ctx context.Context, consumer string, eventID string) (bool, error)
+
+	// Mark records eventID as processed by consumer
+	Mark(ctx context.Context, consumer string, eventID string) error
+}
+
+// TxIdempotencyStore is an IdempotencyStore that can record an event in the
+// same database transaction as the handler's own writes
+type TxIdempotencyStore interface {
+	IdempotencyStore
+
+	// BeginTx starts the transaction passed to a TxHandlerFunc
+	BeginTx(ctx context.Context) (*sql.Tx, error)
+
+	// Claim records eventID as processed by consumer within tx and reports
+	// whether this transaction inserted the record
+	Claim(ctx context.Context, tx *sql.Tx, consumer string, eventID string) (bool, error)
+}
+
+// PostgresIdempotencyStore keeps processed events in the processed_events table
+type PostgresIdempotencyStore struct {
+	db *sql.DB
+}
+
+// NewPostgresIdempotencyStore creates a store on db. The processed_events
+// table is created by Migrate.
+func NewPostgresIdempotencyStore(db *sql.DB) *PostgresIdempotencyStore {
+	return &PostgresIdempotencyStore{
+		db: db,
+	}
+}
+
+// Seen implements IdempotencyStore
+func (s *PostgresIdempotencyStore) Seen(ctx context.Context, consumer string, eventID string) (bool, error) {
+	var exists bool
+	query := `SELECT EXISTS(SELECT 1 FROM processed_events WHERE consumer = $1 AND event_id = $2)`
+	if err := s.db.QueryRowContext(ctx, query, consumer, eventID).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to check processed event: %w", err)
+	}
+	return exists, nil
+}
+
+// Mark implements IdempotencyStore
+func (s *PostgresIdempotencyStore) Mark(ctx context.Context, consumer string, eventID string) error {
+	query := `INSERT INTO processed_events (consumer, event_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	if _, err := s.db.ExecContext(ctx, query, consumer, eventID); err != nil {
+		return fmt.Errorf("failed to mark event processed: %w", err)
+	}
+	return nil
+}
+
+// BeginTx implements TxIdempotencyStore
+func (s *PostgresIdempotencyStore) BeginTx(ctx context.Context) (*sql.Tx, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	return tx, nil
+}
+
+// Claim implements TxIdempotencyStore. A concurrent claim of the same event
+// waits until the first transaction commits or rolls back.
+func (s *PostgresIdempotencyStore) Claim(ctx context.Context, tx *sql.Tx, consumer string, eventID string) (bool, error) {
+	query := `INSERT INTO processed_events (consumer, event_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	res, err := tx.ExecContext(ctx, query, consumer, eventID)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim event: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim event: %w", err)
+	}
+	return n == 1, nil
+}
+
+// Prune deletes entries older than retention and returns how many were
+// removed. Retention must exceed the longest time a message can stay in its
+// stream, or old messages are processed again.
+func (s *PostgresIdempotencyStore) Prune(ctx context.Context, retention time.Duration) (int64, error) {
+	cutoff := time.Now().UTC().Add(-retention)
+	res, err := s.db.ExecContext(ctx, `DELETE FROM processed_events WHERE processed_at < $1`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune processed events: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// RunPruner prunes the store every interval until ctx is cancelled
+func (s *PostgresIdempotencyStore) RunPruner(ctx context.Context, retention time.Duration, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := s.Prune(ctx, retention)
+		if err != nil {
+			log.Printf("Failed to prune processed events: %v", err)
+		} else if n > 0 {
+			log.Printf("Pruned %d processed events", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// MemoryIdempotencyStore keeps the most recently processed events in memory.
+// It suits tests and services that tolerate duplicates after a restart.
+type MemoryIdempotencyStore struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+// NewMemoryIdempotencyStore creates a store that remembers up to capacity
+// events, evicting the least recently used ones first. A capacity below 1
+// makes the store unbounded.
+func NewMemoryIdempotencyStore(capacity int) *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// Seen implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Seen(ctx context.Context, consumer string, eventID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[consumer+"/"+eventID]
+	if ok {
+		s.order.MoveToFront(el)
+	}
+	return ok, nil
+}
+
+// Mark implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Mark(ctx context.Context, consumer string, eventID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := consumer + "/" + eventID
+	if el, ok := s.entries[key]; ok {
+		s.order.MoveToFront(el)
+		return nil
+	}
+
+	s.entries[key] = s.order.PushFront(key)
+	for s.capacity > 0 && s.order.Len() > s.capacity {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(string))
+	}
+	return nil
+}
+
+// KVIdempotencyStore keeps processed events in a JetStream key-value bucket.
+// Configure a TTL on the bucket to expire old entries.
+type KVIdempotencyStore struct {
+	kv nats.KeyValue
+}
+
+// NewKVIdempotencyStore creates a store on kv
+func NewKVIdempotencyStore(kv nats.KeyValue) *KVIdempotencyStore {
+	return &KVIdempotencyStore{
+		kv: kv,
+	}
+}
+
+// Seen implements IdempotencyStore
+func (s *KVIdempotencyStore) Seen(ctx context.Context, consumer string, eventID string) (bool, error) {
+	_, err := s.kv.Get(consumer + "." + eventID)
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check processed event: %w", err)
+	}
+	return true, nil
+}
+
+// Mark implements IdempotencyStore
+func (s *KVIdempotencyStore) Mark(ctx context.Context, consumer string, eventID string) error {
+	_, err := s.kv.Create(consumer+"."+eventID, []byte(time.Now().UTC().Format(time.RFC3339)))
+	if err != nil && !errors.Is(err, nats.ErrKeyExists) {
+		return fmt.Errorf("failed to mark event processed: %w", err)
+	}
+	return nil
+}
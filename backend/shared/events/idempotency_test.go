@@ -0,0 +1,191 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/nats-io/nats.go"
+)
+
+func TestConsumer_StartTx(t *testing.T) {
+	tests := []struct {
+		name        string
+		claimed     int64
+		wantHandled bool
+	}{
+		{name: "first delivery", claimed: 1, wantHandled: true},
+		{name: "duplicate delivery", claimed: 0, wantHandled: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			mock.ExpectBegin()
+			mock.ExpectExec("INSERT INTO processed_events").
+				WithArgs("test-durable", "test-id").
+				WillReturnResult(sqlmock.NewResult(0, tt.claimed))
+			if tt.wantHandled {
+				mock.ExpectExec("UPDATE progress").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			mockJS := &mockJetStream{
+				messages: make(chan *nats.Msg, 1),
+			}
+			consumer := NewConsumer(NewJetStreamBroker(mockJS), "test.subject", "test-durable", WithIdempotencyStore(NewPostgresIdempotencyStore(db)))
+
+			handled := make(chan struct{}, 1)
+			err = consumer.StartTx(context.Background(), func(ctx context.Context, tx *sql.Tx, event Event[any]) error {
+				_, err := tx.ExecContext(ctx, "UPDATE progress SET percent_complete = 100")
+				handled <- struct{}{}
+				return err
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			mockJS.messages <- &nats.Msg{Subject: "test.subject", Data: []byte(`{"id":"test-id","type":"test.event"}`)}
+
+			select {
+			case <-handled:
+				if !tt.wantHandled {
+					t.Error("Expected duplicate event to be skipped")
+				}
+			case <-time.After(100 * time.Millisecond):
+				if tt.wantHandled {
+					t.Error("Expected handler to be called")
+				}
+			}
+
+			_ = consumer.Stop()
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestConsumer_StartTxWithoutTxStore(t *testing.T) {
+	consumer := NewConsumer(NewJetStreamBroker(&mockJetStream{}), "test.subject", "test-durable", WithIdempotencyStore(NewMemoryIdempotencyStore(10)))
+
+	err := consumer.StartTx(context.Background(), func(ctx context.Context, tx *sql.Tx, event Event[any]) error {
+		return nil
+	})
+	if !errors.Is(err, ErrNoTxStore) {
+		t.Errorf("Want ErrNoTxStore, got %v", err)
+	}
+}
+
+func TestPostgresIdempotencyStore_Prune(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec("DELETE FROM processed_events").WillReturnResult(sqlmock.NewResult(0, 3))
+
+	n, err := NewPostgresIdempotencyStore(db).Prune(context.Background(), 7*24*time.Hour)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("Want 3 pruned events, got %d", n)
+	}
+}
+
+func TestMemoryIdempotencyStore(t *testing.T) {
+	store := NewMemoryIdempotencyStore(2)
+	ctx := context.Background()
+
+	_ = store.Mark(ctx, "c", "e1")
+	_ = store.Mark(ctx, "c", "e2")
+
+	// Touch e1 so that e2 is the least recently used entry
+	if seen, _ := store.Seen(ctx, "c", "e1"); !seen {
+		t.Error("Expected e1 to be seen")
+	}
+	_ = store.Mark(ctx, "c", "e3")
+
+	tests := []struct {
+		consumer string
+		eventID  string
+		want     bool
+	}{
+		{"c", "e1", true},
+		{"c", "e2", false},
+		{"c", "e3", true},
+		{"other", "e1", false},
+	}
+	for _, tt := range tests {
+		if got, _ := store.Seen(ctx, tt.consumer, tt.eventID); got != tt.want {
+			t.Errorf("Seen(%q, %q) = %v, want %v", tt.consumer, tt.eventID, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryIdempotencyStore_Unbounded(t *testing.T) {
+	store := NewMemoryIdempotencyStore(0)
+	ctx := context.Background()
+
+	for i := range 100 {
+		_ = store.Mark(ctx, "c", fmt.Sprint(i))
+	}
+	for i := range 100 {
+		if seen, _ := store.Seen(ctx, "c", fmt.Sprint(i)); !seen {
+			t.Fatalf("Want event %d kept by an unbounded store", i)
+		}
+	}
+}
+
+// mockKeyValue implements the key-value operations used by KVIdempotencyStore
+type mockKeyValue struct {
+	nats.KeyValue
+	keys map[string]bool
+}
+
+func (m *mockKeyValue) Get(key string) (nats.KeyValueEntry, error) {
+	if !m.keys[key] {
+		return nil, nats.ErrKeyNotFound
+	}
+	return nil, nil
+}
+
+func (m *mockKeyValue) Create(key string, value []byte) (uint64, error) {
+	if m.keys[key] {
+		return 0, nats.ErrKeyExists
+	}
+	m.keys[key] = true
+	return 1, nil
+}
+
+func TestKVIdempotencyStore(t *testing.T) {
+	kv := &mockKeyValue{keys: make(map[string]bool)}
+	store := NewKVIdempotencyStore(kv)
+	ctx := context.Background()
+
+	if seen, err := store.Seen(ctx, "c", "e1"); err != nil || seen {
+		t.Fatalf("Want unseen event, got %v, %v", seen, err)
+	}
+	if err := store.Mark(ctx, "c", "e1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := store.Mark(ctx, "c", "e1"); err != nil {
+		t.Fatalf("Expected marking twice to succeed, got %v", err)
+	}
+	if seen, err := store.Seen(ctx, "c", "e1"); err != nil || !seen {
+		t.Fatalf("Want seen event, got %v, %v", seen, err)
+	}
+}
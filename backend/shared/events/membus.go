@@ -0,0 +1,389 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// MemoryStream is the stream name reported by MemoryBroker acknowledgements
+const MemoryStream = "MEMORY"
+
+// ErrSubscriptionClosed is returned when draining or unsubscribing a
+// MemoryBroker subscription that already ended
+var ErrSubscriptionClosed = errors.New("subscription closed")
+
+// MemoryBroker is an in-process Broker with the JetStream semantics the
+// events package relies on: durables keep their position while nobody is
+// subscribed, unacknowledged messages are redelivered after the AckWait or
+// the Nak delay, messages are deduplicated by their Nats-Msg-Id header and
+// the Nats-Expected-Last-Subject-Sequence header is enforced. All subjects
+// share one stream, so sequences are global. Messages are kept for the
+// lifetime of the broker.
+type MemoryBroker struct {
+	mu       sync.Mutex
+	msgs     []memoryMsg
+	ids      map[string]uint64 // Message ID to stream sequence
+	last     map[string]uint64 // Subject to the sequence of its last message
+	durables map[string]*memoryDurable
+	changed  chan struct{} // Closed and replaced whenever a message is stored or settled
+}
+
+type memoryMsg struct {
+	msg  *nats.Msg
+	time time.Time
+}
+
+// memoryDurable is the delivery state of a durable consumer
+type memoryDurable struct {
+	name      string
+	subject   string
+	ackWait   time.Duration
+	next      uint64 // Next stream sequence to look at
+	delivered uint64 // Consumer sequence of the last delivery
+	pending   map[uint64]*memoryPending
+}
+
+// memoryPending is a delivered message awaiting its acknowledgement
+type memoryPending struct {
+	deliveries uint64
+	due        time.Time // Redelivered once due has passed
+}
+
+// NewMemoryBroker creates an empty MemoryBroker
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		ids:      make(map[string]uint64),
+		last:     make(map[string]uint64),
+		durables: make(map[string]*memoryDurable),
+		changed:  make(chan struct{}),
+	}
+}
+
+// Publish implements Broker
+func (b *MemoryBroker) Publish(ctx context.Context, msg *nats.Msg) (*nats.PubAck, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := msg.Header.Get(nats.MsgIdHdr)
+	if seq, ok := b.ids[id]; ok && id != "" {
+		return &nats.PubAck{Stream: MemoryStream, Sequence: seq, Duplicate: true}, nil
+	}
+
+	if expected := msg.Header.Get(nats.ExpectedLastSubjSeqHdr); expected != "" {
+		want, err := strconv.ParseUint(expected, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s header: %w", nats.ExpectedLastSubjSeqHdr, err)
+		}
+		if last := b.last[msg.Subject]; last != want {
+			return nil, &nats.APIError{
+				Code:        400,
+				ErrorCode:   nats.JSErrCodeStreamWrongLastSequence,
+				Description: fmt.Sprintf("wrong last sequence: %d", last),
+			}
+		}
+	}
+
+	stored := &nats.Msg{
+		Subject: msg.Subject,
+		Header:  maps.Clone(msg.Header),
+		Data:    slices.Clone(msg.Data),
+	}
+	b.msgs = append(b.msgs, memoryMsg{msg: stored, time: time.Now().UTC()})
+	seq := uint64(len(b.msgs))
+	if id != "" {
+		b.ids[id] = seq
+	}
+	b.last[msg.Subject] = seq
+	b.notify()
+
+	return &nats.PubAck{Stream: MemoryStream, Sequence: seq}, nil
+}
+
+// PublishAsync implements Broker. The message is stored before it returns.
+func (b *MemoryBroker) PublishAsync(msg *nats.Msg) (nats.PubAckFuture, error) {
+	f := &memoryPubAckFuture{msg: msg, ok: make(chan *nats.PubAck, 1), err: make(chan error, 1)}
+	ack, err := b.Publish(context.Background(), msg)
+	if err != nil {
+		f.err <- err
+	} else {
+		f.ok <- ack
+	}
+	return f, nil
+}
+
+// Subscribe implements Broker. The durable is created on first use and kept
+// when the subscription ends, so later subscriptions continue where it left
+// off. Several subscriptions of one durable share its messages. Push and pull
+// subscriptions behave the same; Stream is ignored.
+func (b *MemoryBroker) Subscribe(ctx context.Context, cfg SubscribeConfig, handler func(Delivery)) (Subscription, error) {
+	if cfg.Durable == "" {
+		return nil, errors.New("durable name is required")
+	}
+
+	b.mu.Lock()
+	d, ok := b.durables[cfg.Durable]
+	if !ok {
+		d = &memoryDurable{
+			name:    cfg.Durable,
+			subject: cfg.Subject,
+			next:    1,
+			pending: make(map[uint64]*memoryPending),
+		}
+		b.durables[cfg.Durable] = d
+	}
+	if d.subject != cfg.Subject {
+		b.mu.Unlock()
+		return nil, fmt.Errorf("durable %s already subscribes to %s", cfg.Durable, d.subject)
+	}
+	d.ackWait = cfg.AckWait
+	if d.ackWait <= 0 {
+		d.ackWait = 30 * time.Second
+	}
+	b.mu.Unlock()
+
+	s := &memorySubscription{
+		broker:  b,
+		durable: d,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go s.loop(ctx, handler)
+	return s, nil
+}
+
+// notify wakes up every subscription. The lock must be held.
+func (b *MemoryBroker) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// next returns the next delivery for d: the oldest message whose redelivery
+// is due, or else the next new message of its subject. When there is none, it
+// returns how long to wait for the next redelivery, or zero if there is no
+// pending message. The lock must be held.
+func (b *MemoryBroker) next(d *memoryDurable) (*memoryDelivery, time.Duration) {
+	now := time.Now()
+
+	var wait time.Duration
+	for _, seq := range slices.Sorted(maps.Keys(d.pending)) {
+		p := d.pending[seq]
+		if !p.due.After(now) {
+			return b.deliver(d, seq, p, now), 0
+		}
+		if until := p.due.Sub(now); wait == 0 || until < wait {
+			wait = until
+		}
+	}
+
+	for ; d.next <= uint64(len(b.msgs)); d.next++ {
+		seq := d.next
+		if subjectMatches(d.subject, b.msgs[seq-1].msg.Subject) {
+			d.next++
+			p := &memoryPending{}
+			d.pending[seq] = p
+			return b.deliver(d, seq, p, now), 0
+		}
+	}
+	return nil, wait
+}
+
+// deliver records a delivery of the message at seq. The lock must be held.
+func (b *MemoryBroker) deliver(d *memoryDurable, seq uint64, p *memoryPending, now time.Time) *memoryDelivery {
+	p.deliveries++
+	p.due = now.Add(d.ackWait)
+	d.delivered++
+
+	var pending uint64
+	for _, m := range b.msgs[d.next-1:] {
+		if subjectMatches(d.subject, m.msg.Subject) {
+			pending++
+		}
+	}
+
+	stored := b.msgs[seq-1]
+	return &memoryDelivery{
+		broker:  b,
+		durable: d,
+		seq:     seq,
+		msg: &nats.Msg{
+			Subject: stored.msg.Subject,
+			Header:  maps.Clone(stored.msg.Header),
+			Data:    slices.Clone(stored.msg.Data),
+		},
+		meta: &nats.MsgMetadata{
+			Sequence:     nats.SequencePair{Consumer: d.delivered, Stream: seq},
+			NumDelivered: p.deliveries,
+			NumPending:   pending,
+			Timestamp:    stored.time,
+			Stream:       MemoryStream,
+			Consumer:     d.name,
+		},
+	}
+}
+
+// settle updates the pending message seq of d. A nil due removes it.
+func (b *MemoryBroker) settle(d *memoryDurable, seq uint64, due *time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	p, ok := d.pending[seq]
+	if !ok {
+		return nats.ErrMsgAlreadyAckd
+	}
+	if due == nil {
+		delete(d.pending, seq)
+	} else {
+		p.due = *due
+	}
+	b.notify()
+	return nil
+}
+
+// memorySubscription delivers the messages of a durable on its own goroutine
+type memorySubscription struct {
+	broker  *MemoryBroker
+	durable *memoryDurable
+	once    sync.Once
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func (s *memorySubscription) loop(ctx context.Context, handler func(Delivery)) {
+	defer close(s.done)
+
+	b := s.broker
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.stop:
+			return
+		default:
+		}
+
+		b.mu.Lock()
+		delivery, wait := b.next(s.durable)
+		changed := b.changed
+		b.mu.Unlock()
+
+		if delivery != nil {
+			handler(delivery)
+			continue
+		}
+
+		var timer *time.Timer
+		var due <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			due = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-s.stop:
+		case <-changed:
+		case <-due:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// Drain implements Subscription. The message being handed to the handler, if
+// any, is the only one still delivered.
+func (s *memorySubscription) Drain() (<-chan struct{}, error) {
+	if err := s.Unsubscribe(); err != nil {
+		return nil, err
+	}
+	return s.done, nil
+}
+
+// Unsubscribe implements Subscription
+func (s *memorySubscription) Unsubscribe() error {
+	err := ErrSubscriptionClosed
+	s.once.Do(func() {
+		close(s.stop)
+		err = nil
+	})
+	return err
+}
+
+// memoryDelivery is a Delivery of a MemoryBroker
+type memoryDelivery struct {
+	broker  *MemoryBroker
+	durable *memoryDurable
+	seq     uint64
+	msg     *nats.Msg
+	meta    *nats.MsgMetadata
+}
+
+// Msg implements Delivery
+func (d *memoryDelivery) Msg() *nats.Msg {
+	return d.msg
+}
+
+// Metadata implements Delivery
+func (d *memoryDelivery) Metadata() (*nats.MsgMetadata, error) {
+	return d.meta, nil
+}
+
+// Ack implements Delivery
+func (d *memoryDelivery) Ack() error {
+	return d.broker.settle(d.durable, d.seq, nil)
+}
+
+// Nak implements Delivery
+func (d *memoryDelivery) Nak(delay time.Duration) error {
+	due := time.Now().Add(delay)
+	return d.broker.settle(d.durable, d.seq, &due)
+}
+
+// InProgress implements Delivery
+func (d *memoryDelivery) InProgress() error {
+	due := time.Now().Add(d.durable.ackWait)
+	return d.broker.settle(d.durable, d.seq, &due)
+}
+
+// Term implements Delivery
+func (d *memoryDelivery) Term() error {
+	return d.broker.settle(d.durable, d.seq, nil)
+}
+
+type memoryPubAckFuture struct {
+	msg *nats.Msg
+	ok  chan *nats.PubAck
+	err chan error
+}
+
+func (f *memoryPubAckFuture) Ok() <-chan *nats.PubAck { return f.ok }
+func (f *memoryPubAckFuture) Err() <-chan error       { return f.err }
+func (f *memoryPubAckFuture) Msg() *nats.Msg          { return f.msg }
+
+// subjectMatches reports whether subject matches pattern, which may contain
+// the NATS wildcards * and >
+func subjectMatches(pattern, subject string) bool {
+	patterns := strings.Split(pattern, ".")
+	tokens := strings.Split(subject, ".")
+	for i, p := range patterns {
+		if p == ">" {
+			return len(tokens) > i
+		}
+		if i >= len(tokens) || (p != "*" && p != tokens[i]) {
+			return false
+		}
+	}
+	return len(patterns) == len(tokens)
+}
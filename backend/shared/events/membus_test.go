@@ -0,0 +1,270 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func publishMemory(t *testing.T, b *MemoryBroker, subject, id string) *nats.PubAck {
+	t.Helper()
+	msg := nats.NewMsg(subject)
+	msg.Header.Set(nats.MsgIdHdr, id)
+	msg.Data = []byte(id)
+	ack, err := b.Publish(context.Background(), msg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return ack
+}
+
+func receive(t *testing.T, ch <-chan Delivery) Delivery {
+	t.Helper()
+	select {
+	case d := <-ch:
+		return d
+	case <-time.After(time.Second):
+		t.Fatal("Expected a delivery")
+		return nil
+	}
+}
+
+func TestMemoryBroker_Publish(t *testing.T) {
+	b := NewMemoryBroker()
+
+	if ack := publishMemory(t, b, "course.updated", "e1"); ack.Sequence != 1 || ack.Duplicate {
+		t.Errorf("Want sequence 1, got %+v", ack)
+	}
+	if ack := publishMemory(t, b, "course.updated", "e1"); ack.Sequence != 1 || !ack.Duplicate {
+		t.Errorf("Want duplicate of sequence 1, got %+v", ack)
+	}
+
+	msg := nats.NewMsg("course.updated")
+	msg.Header.Set(nats.ExpectedLastSubjSeqHdr, "0")
+	_, err := b.Publish(context.Background(), msg)
+	var apiErr *nats.APIError
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode != nats.JSErrCodeStreamWrongLastSequence {
+		t.Errorf("Want wrong last sequence error, got %v", err)
+	}
+
+	msg.Header.Set(nats.ExpectedLastSubjSeqHdr, "1")
+	if ack, err := b.Publish(context.Background(), msg); err != nil || ack.Sequence != 2 {
+		t.Errorf("Want sequence 2, got %+v, %v", ack, err)
+	}
+}
+
+func TestMemoryBroker_Redelivery(t *testing.T) {
+	b := NewMemoryBroker()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	deliveries := make(chan Delivery, 10)
+	_, err := b.Subscribe(ctx, SubscribeConfig{Subject: "progress.>", Durable: "test", AckWait: 50 * time.Millisecond},
+		func(d Delivery) { deliveries <- d })
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	publishMemory(t, b, "progress.updated", "e1")
+	first := receive(t, deliveries)
+	if err := first.Nak(0); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	again := receive(t, deliveries)
+	meta, _ := again.Metadata()
+	if string(again.Msg().Data) != "e1" || meta.NumDelivered != 2 {
+		t.Errorf("Want e1 delivered twice, got %s delivered %d times", again.Msg().Data, meta.NumDelivered)
+	}
+	if err := again.Ack(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := again.Ack(); !errors.Is(err, nats.ErrMsgAlreadyAckd) {
+		t.Errorf("Want ErrMsgAlreadyAckd, got %v", err)
+	}
+
+	publishMemory(t, b, "course.updated", "e2") // Not matched
+	publishMemory(t, b, "progress.lesson.completed", "e3")
+
+	// Not acknowledged, so redelivered after the AckWait
+	third := receive(t, deliveries)
+	meta, _ = third.Metadata()
+	if string(third.Msg().Data) != "e3" || meta.Sequence.Stream != 3 || meta.NumPending != 0 {
+		t.Errorf("Want e3 at sequence 3, got %s with %+v", third.Msg().Data, meta)
+	}
+	redelivered := receive(t, deliveries)
+	if meta, _ := redelivered.Metadata(); meta.Sequence.Stream != 3 || meta.NumDelivered != 2 {
+		t.Errorf("Want sequence 3 redelivered, got %+v", meta)
+	}
+	_ = redelivered.Term()
+
+	select {
+	case d := <-deliveries:
+		t.Errorf("Unexpected delivery of %s", d.Msg().Data)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestMemoryBroker_Durable(t *testing.T) {
+	b := NewMemoryBroker()
+	cfg := SubscribeConfig{Subject: "course.updated", Durable: "test"}
+
+	deliveries := make(chan Delivery, 10)
+	sub, err := b.Subscribe(context.Background(), cfg, func(d Delivery) {
+		_ = d.Ack()
+		deliveries <- d
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	publishMemory(t, b, "course.updated", "e1")
+	receive(t, deliveries)
+
+	closed, err := sub.Drain()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	<-closed
+	if err := sub.Unsubscribe(); !errors.Is(err, ErrSubscriptionClosed) {
+		t.Errorf("Want ErrSubscriptionClosed, got %v", err)
+	}
+
+	// Published while nobody is subscribed
+	publishMemory(t, b, "course.updated", "e2")
+
+	sub, err = b.Subscribe(context.Background(), cfg, func(d Delivery) {
+		_ = d.Ack()
+		deliveries <- d
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	if d := receive(t, deliveries); string(d.Msg().Data) != "e2" {
+		t.Errorf("Want the durable to resume at e2, got %s", d.Msg().Data)
+	}
+
+	if _, err := b.Subscribe(context.Background(), SubscribeConfig{Subject: "course.deleted", Durable: "test"}, func(Delivery) {}); err == nil {
+		t.Error("Expected an error for a durable with another subject")
+	}
+}
+
+func TestSubjectMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		subject string
+		want    bool
+	}{
+		{"course.updated", "course.updated", true},
+		{"course.updated", "course.deleted", false},
+		{"course.*", "course.updated", true},
+		{"course.*", "course.enrollment.created", false},
+		{"course.>", "course.enrollment.created", true},
+		{"course.>", "course", false},
+		{"*.updated", "progress.updated", true},
+		{"course", "course.updated", false},
+	}
+
+	for _, tt := range tests {
+		if got := subjectMatches(tt.pattern, tt.subject); got != tt.want {
+			t.Errorf("subjectMatches(%q, %q) = %v, want %v", tt.pattern, tt.subject, got, tt.want)
+		}
+	}
+}
+
+// TestMemoryBroker_EnrollmentFlow runs the enrollment flow across the course,
+// progress and notification services on one in-memory bus
+func TestMemoryBroker_EnrollmentFlow(t *testing.T) {
+	b := NewMemoryBroker()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	course := NewPublisher(b, "course-service", WithPublishValidation())
+	progress := NewPublisher(b, "progress-service")
+	notification := NewPublisher(b, "notification-service")
+
+	// The progress service starts tracking the new enrollment
+	progressConsumer := NewConsumer(b, TypeUserEnrolled, "progress-service",
+		WithIdempotencyStore(NewMemoryIdempotencyStore(10)))
+	err := progressConsumer.Start(ctx, func(ctx context.Context, event Event[any]) error {
+		enrolled := event.Data.(UserEnrolledEvent)
+		return progress.Publish(ctx, Event[any]{
+			Type: TypeProgressUpdated,
+			Data: &ProgressUpdatedEvent{UserID: enrolled.UserID, CourseID: enrolled.CourseID, UpdatedAt: time.Now().UTC()},
+		})
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The notification service fails once and succeeds on redelivery
+	var mu sync.Mutex
+	attempts := 0
+	notificationConsumer := NewConsumer(b, TypeUserEnrolled, "notification-service",
+		WithIdempotencyStore(NewMemoryIdempotencyStore(10)), WithBackoff(time.Millisecond, time.Millisecond))
+	err = notificationConsumer.Start(ctx, func(ctx context.Context, event Event[any]) error {
+		mu.Lock()
+		attempts++
+		first := attempts == 1
+		mu.Unlock()
+		if first {
+			return errors.New("mail server unavailable")
+		}
+
+		enrolled := event.Data.(UserEnrolledEvent)
+		return notification.Publish(ctx, Event[any]{
+			Type: TypeNotificationSent,
+			Data: &NotificationSentEvent{ID: "n1", UserID: enrolled.UserID, Type: "enrollment", Channels: []string{"email"}, SentAt: time.Now().UTC()},
+		})
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The analytics service observes everything that follows
+	observed := make(chan Event[any], 10)
+	analytics := NewConsumer(b, ">", "analytics-service")
+	err = analytics.Start(ctx, func(ctx context.Context, event Event[any]) error {
+		observed <- event
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	enrollment := Event[any]{
+		Type: TypeUserEnrolled,
+		Data: &UserEnrolledEvent{ID: "en1", CourseID: "c1", UserID: "u1", EnrolledAt: time.Now().UTC()},
+	}
+	if err := course.Publish(ctx, enrollment); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	byType := make(map[string]Event[any])
+	for len(byType) < 3 {
+		select {
+		case e := <-observed:
+			byType[e.Type] = e
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Want 3 event types, got %d", len(byType))
+		}
+	}
+
+	enrolled := byType[TypeUserEnrolled]
+	for _, eventType := range []string{TypeProgressUpdated, TypeNotificationSent} {
+		e := byType[eventType]
+		if e.CausationID != enrolled.ID || e.CorrelationID != enrolled.CorrelationID {
+			t.Errorf("Want %s caused by %s in correlation %s, got %s in %s",
+				eventType, enrolled.ID, enrolled.CorrelationID, e.CausationID, e.CorrelationID)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts != 2 {
+		t.Errorf("Want the notification handler to run twice, got %d", attempts)
+	}
+}
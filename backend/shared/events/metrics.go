@@ -0,0 +1,102 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/SteinerLabs/lms/backend/shared/metrics"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics are the Prometheus collectors of publishers and consumers.
+// Publisher metrics are labelled by event type, consumer metrics by durable
+// and event type.
+type Metrics struct {
+	publishDuration *prometheus.HistogramVec
+	publishFailures *prometheus.CounterVec
+	consumerLag     *prometheus.GaugeVec
+	handleDuration  *prometheus.HistogramVec
+	naks            *prometheus.CounterVec
+	redeliveries    *prometheus.CounterVec
+	duplicates      *prometheus.CounterVec
+	deadLetters     *prometheus.CounterVec
+}
+
+// NewMetrics creates the collectors and registers them on reg. It panics if
+// reg already holds them, so create one Metrics per registry.
+func NewMetrics(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		publishDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "events",
+			Name:      "publish_duration_seconds",
+			Help:      "Time until a published event was acknowledged by the stream.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"type"}),
+		publishFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "events",
+			Name:      "publish_failures_total",
+			Help:      "Events that failed to publish.",
+		}, []string{"type"}),
+		consumerLag: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "events",
+			Name:      "consumer_lag_messages",
+			Help:      "Messages waiting for the consumer, as of its last delivery.",
+		}, []string{"durable"}),
+		handleDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "events",
+			Name:      "handler_duration_seconds",
+			Help:      "Time spent handling an event, including the idempotency check.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"durable", "type"}),
+		naks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "events",
+			Name:      "naks_total",
+			Help:      "Deliveries negatively acknowledged for a retry.",
+		}, []string{"durable", "type"}),
+		redeliveries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "events",
+			Name:      "redeliveries_total",
+			Help:      "Messages delivered to the consumer more than once.",
+		}, []string{"durable", "type"}),
+		duplicates: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "events",
+			Name:      "duplicates_total",
+			Help:      "Events skipped because the consumer had already processed them.",
+		}, []string{"durable", "type"}),
+		deadLetters: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "events",
+			Name:      "dead_letters_total",
+			Help:      "Messages moved to their dead-letter subject.",
+		}, []string{"durable", "type"}),
+	}
+	reg.MustRegister(m.publishDuration, m.publishFailures, m.consumerLag, m.handleDuration,
+		m.naks, m.redeliveries, m.duplicates, m.deadLetters)
+	return m
+}
+
+var defaultMetrics = sync.OnceValue(func() *Metrics {
+	return NewMetrics(metrics.Registry)
+})
+
+// DefaultMetrics returns the metrics registered on metrics.Registry, which
+// publishers and consumers report to unless configured otherwise
+func DefaultMetrics() *Metrics {
+	return defaultMetrics()
+}
+
+// published records the outcome of publishing an event of eventType that
+// started at start
+func (m *Metrics) published(eventType string, start time.Time, err error) {
+	if err != nil {
+		m.publishFailures.WithLabelValues(eventType).Inc()
+		return
+	}
+	m.publishDuration.WithLabelValues(eventType).Observe(time.Since(start).Seconds())
+}
+
+// typeOf returns the event type of msg from its header, as the payload may
+// not have been decoded
+func typeOf(msg *nats.Msg) string {
+	return msg.Header.Get(EventTypeHeader)
+}
@@ -0,0 +1,100 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics(prometheus.NewRegistry())
+	b := NewMemoryBroker()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The handler fails the first delivery of e1; e2 was already processed
+	store := NewMemoryIdempotencyStore(10)
+	handled := make(chan struct{}, 10)
+	var mu sync.Mutex
+	attempts := 0
+	consumer := NewConsumer(b, "course.>", "metrics-test", WithConsumerMetrics(m),
+		WithIdempotencyStore(store), WithBackoff(time.Millisecond, time.Millisecond))
+	err := consumer.Start(ctx, func(ctx context.Context, event Event[any]) error {
+		defer func() { handled <- struct{}{} }()
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts == 1 {
+			return errors.New("database unavailable")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	publisher := NewPublisher(b, "course-service", WithPublisherMetrics(m))
+	if err := store.Mark(ctx, "metrics-test", "e2"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, id := range []string{"e1", "e2"} {
+		if err := publisher.Publish(ctx, Event[any]{ID: id, Type: TypeCourseUpdated, Data: &CourseUpdatedEvent{ID: "c1"}}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	// Two attempts of e1; e2 skips the handler
+	for range 2 {
+		select {
+		case <-handled:
+		case <-time.After(time.Second):
+			t.Fatal("Expected the handler to run")
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for testutil.ToFloat64(m.duplicates.WithLabelValues("metrics-test", TypeCourseUpdated)) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	tests := []struct {
+		name      string
+		collector prometheus.Collector
+		want      float64
+	}{
+		{"naks", m.naks.WithLabelValues("metrics-test", TypeCourseUpdated), 1},
+		{"redeliveries", m.redeliveries.WithLabelValues("metrics-test", TypeCourseUpdated), 1},
+		{"duplicates", m.duplicates.WithLabelValues("metrics-test", TypeCourseUpdated), 1},
+		{"dead letters", m.deadLetters.WithLabelValues("metrics-test", TypeCourseUpdated), 0},
+		{"publish failures", m.publishFailures.WithLabelValues(TypeCourseUpdated), 0},
+		{"consumer lag", m.consumerLag.WithLabelValues("metrics-test"), 0},
+	}
+	for _, tt := range tests {
+		if got := testutil.ToFloat64(tt.collector); got != tt.want {
+			t.Errorf("Want %s %v, got %v", tt.name, tt.want, got)
+		}
+	}
+	if n := testutil.CollectAndCount(m.publishDuration); n != 1 {
+		t.Errorf("Want publish durations for one type, got %d", n)
+	}
+	if n := testutil.CollectAndCount(m.handleDuration); n != 1 {
+		t.Errorf("Want handler durations for one type, got %d", n)
+	}
+}
+
+func TestMetrics_PublishFailure(t *testing.T) {
+	m := NewMetrics(prometheus.NewRegistry())
+	js := &recordingJetStream{fail: map[string]bool{TypeCourseDeleted: true}}
+	publisher := NewPublisher(NewJetStreamBroker(js), "course-service", WithPublisherMetrics(m))
+
+	if err := publisher.Publish(context.Background(), Event[any]{Type: TypeCourseDeleted}); err == nil {
+		t.Fatal("Expected an error")
+	}
+	if got := testutil.ToFloat64(m.publishFailures.WithLabelValues(TypeCourseDeleted)); got != 1 {
+		t.Errorf("Want 1 publish failure, got %v", got)
+	}
+}
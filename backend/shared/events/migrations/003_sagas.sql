@@ -0,0 +1,18 @@
+-- Saga instances for events.Saga
+
+CREATE TABLE IF NOT EXISTS sagas (
+    saga VARCHAR(255) NOT NULL,
+    correlation_id VARCHAR(255) NOT NULL,
+    status VARCHAR(32) NOT NULL,
+    steps JSONB NOT NULL DEFAULT '[]',
+    compensated JSONB NOT NULL DEFAULT '[]',
+    state JSONB NOT NULL DEFAULT '{}',
+    error TEXT NOT NULL DEFAULT '',
+    deadline TIMESTAMPTZ,
+    version INT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (saga, correlation_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_sagas_deadline ON sagas (saga, deadline) WHERE deadline IS NOT NULL;
@@ -0,0 +1,19 @@
+-- Aggregate streams and snapshots for events.EventStore
+
+CREATE TABLE IF NOT EXISTS event_store (
+    position BIGSERIAL PRIMARY KEY,
+    stream_id VARCHAR(255) NOT NULL,
+    version INT NOT NULL,
+    event_id VARCHAR(36) NOT NULL UNIQUE,
+    event_type VARCHAR(255) NOT NULL,
+    payload JSONB NOT NULL,
+    recorded_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (stream_id, version)
+);
+
+CREATE TABLE IF NOT EXISTS event_store_snapshots (
+    stream_id VARCHAR(255) PRIMARY KEY,
+    version INT NOT NULL,
+    state JSONB NOT NULL,
+    taken_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
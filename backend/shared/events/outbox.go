@@ -0,0 +1,278 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// outboxLockID is the Postgres advisory lock that serialises relays, so that
+// events of one aggregate are never published out of order by two relays.
+const outboxLockID int64 = 0x6f7574626f78
+
+// Execer is implemented by *sql.DB, *sql.Tx, *sqlx.DB and *sqlx.Tx
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// Outbox stores events in the event_outbox table as part of the caller's
+// database transaction and relays them to JetStream once committed. Events
+// are delivered at least once and in order per aggregate.
+type Outbox struct {
+	db          *sql.DB
+	publisher   *Publisher
+	batchSize   int
+	interval    time.Duration
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+}
+
+// OutboxOption configures optional Outbox behaviour
+type OutboxOption func(*Outbox)
+
+// WithOutboxBatchSize sets the number of events read per relay iteration
+func WithOutboxBatchSize(n int) OutboxOption {
+	return func(o *Outbox) {
+		o.batchSize = n
+	}
+}
+
+// WithOutboxInterval sets how often the relay polls for new events
+func WithOutboxInterval(d time.Duration) OutboxOption {
+	return func(o *Outbox) {
+		o.interval = d
+	}
+}
+
+// WithOutboxBackoff sets the exponential backoff between publish attempts of
+// an event that failed to publish
+func WithOutboxBackoff(base, max time.Duration) OutboxOption {
+	return func(o *Outbox) {
+		o.baseBackoff = base
+		o.maxBackoff = max
+	}
+}
+
+// NewOutbox creates an outbox that relays through publisher
+func NewOutbox(db *sql.DB, publisher *Publisher, opts ...OutboxOption) *Outbox {
+	o := &Outbox{
+		db:          db,
+		publisher:   publisher,
+		batchSize:   100,
+		interval:    time.Second,
+		baseBackoff: time.Second,
+		maxBackoff:  5 * time.Minute,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Add writes event to the outbox using tx, which should be the transaction
+// that holds the state change the event describes. The event is enriched
+// from ctx and validated the same way Publisher.Publish does. Outbox events
+// are stored and relayed as JSON whatever codec the publisher uses.
+func (o *Outbox) Add(ctx context.Context, tx Execer, aggregateID string, event Event[any]) error {
+	o.publisher.enrich(ctx, &event)
+
+	payload, err := o.publisher.marshal(event)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO event_outbox (event_id, aggregate_id, event_type, payload) VALUES ($1, $2, $3, $4)`
+	if _, err := tx.ExecContext(ctx, query, event.ID, aggregateID, event.Type, payload); err != nil {
+		return fmt.Errorf("failed to add event to outbox: %w", err)
+	}
+	return nil
+}
+
+// Run relays outbox events until ctx is cancelled
+func (o *Outbox) Run(ctx context.Context) error {
+	ticker := time.NewTicker(o.interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := o.Relay(ctx)
+		if err != nil {
+			log.Printf("Failed to relay outbox: %v", err)
+		}
+		if n == o.batchSize {
+			// More events are likely waiting
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Prune deletes events published before retention ago and returns how many
+// were removed. Unpublished events are kept whatever their age.
+func (o *Outbox) Prune(ctx context.Context, retention time.Duration) (int64, error) {
+	cutoff := time.Now().UTC().Add(-retention)
+	res, err := o.db.ExecContext(ctx, `DELETE FROM event_outbox WHERE published_at < $1`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune outbox: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// RunPruner prunes the outbox every interval until ctx is cancelled
+func (o *Outbox) RunPruner(ctx context.Context, retention time.Duration, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := o.Prune(ctx, retention)
+		if err != nil {
+			log.Printf("Failed to prune outbox: %v", err)
+		} else if n > 0 {
+			log.Printf("Pruned %d published outbox events", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+type outboxEntry struct {
+	id          int64
+	eventID     string
+	aggregateID string
+	eventType   string
+	payload     []byte
+	attempts    int
+}
+
+// Relay publishes one batch of due events in insertion order and returns how
+// many were published. Once an event of an aggregate fails or is waiting for
+// its retry, later events of the same aggregate are held back.
+func (o *Outbox) Relay(ctx context.Context) (int, error) {
+	tx, err := o.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRowContext(ctx, "SELECT pg_try_advisory_xact_lock($1)", outboxLockID).Scan(&locked); err != nil {
+		return 0, fmt.Errorf("failed to acquire outbox lock: %w", err)
+	}
+	if !locked {
+		// Another relay is running
+		return 0, nil
+	}
+
+	now := time.Now().UTC()
+	entries, err := o.pending(ctx, tx, now)
+	if err != nil {
+		return 0, err
+	}
+
+	blocked := make(map[string]bool)
+	published := 0
+	for _, e := range entries {
+		if blocked[e.aggregateID] {
+			continue
+		}
+
+		event := metadataOf(e.payload)
+		event.ID, event.Type = e.eventID, e.eventType
+		if _, err := o.publisher.send(ctx, event, ContentTypeJSON, e.payload); err != nil {
+			blocked[e.aggregateID] = true
+			log.Printf("Failed to publish outbox event %s: %v", e.eventID, err)
+
+			next := now.Add(backoff(e.attempts+1, o.baseBackoff, o.maxBackoff))
+			query := `UPDATE event_outbox SET attempts = attempts + 1, last_error = $1, next_attempt_at = $2 WHERE id = $3`
+			if _, err := tx.ExecContext(ctx, query, err.Error(), next, e.id); err != nil {
+				return published, fmt.Errorf("failed to record outbox failure: %w", err)
+			}
+			continue
+		}
+
+		query := `UPDATE event_outbox SET published_at = $1 WHERE id = $2`
+		if _, err := tx.ExecContext(ctx, query, now, e.id); err != nil {
+			return published, fmt.Errorf("failed to mark outbox event published: %w", err)
+		}
+		published++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return published, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return published, nil
+}
+
+// pending returns unpublished events that are due and not preceded by an
+// event of the same aggregate that is still waiting for a retry
+func (o *Outbox) pending(ctx context.Context, tx *sql.Tx, now time.Time) ([]outboxEntry, error) {
+	query := `SELECT o.id, o.event_id, o.aggregate_id, o.event_type, o.payload, o.attempts
+		FROM event_outbox o
+		WHERE o.published_at IS NULL AND o.next_attempt_at <= $1
+		AND NOT EXISTS (
+			SELECT 1 FROM event_outbox p
+			WHERE p.aggregate_id = o.aggregate_id AND p.published_at IS NULL
+			AND p.id < o.id AND p.next_attempt_at > $1
+		)
+		ORDER BY o.id LIMIT $2`
+	rows, err := tx.QueryContext(ctx, query, now, o.batchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query outbox: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []outboxEntry
+	for rows.Next() {
+		var e outboxEntry
+		if err := rows.Scan(&e.id, &e.eventID, &e.aggregateID, &e.eventType, &e.payload, &e.attempts); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox entry: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// metadataOf returns the envelope of a JSON encoded event without its data
+func metadataOf(payload []byte) Event[any] {
+	var event Event[json.RawMessage]
+	_ = json.Unmarshal(payload, &event)
+	return Event[any]{
+		ID:            event.ID,
+		TraceID:       event.TraceID,
+		CorrelationID: event.CorrelationID,
+		CausationID:   event.CausationID,
+		Source:        event.Source,
+		TenantID:      event.TenantID,
+		ActorID:       event.ActorID,
+		Type:          event.Type,
+		SchemaVersion: event.SchemaVersion,
+		OccurredAt:    event.OccurredAt,
+	}
+}
+
+// backoff returns the exponential delay before the given attempt, starting at
+// base and capped at max
+func backoff(attempt int, base, max time.Duration) time.Duration {
+	d := base
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if d >= max {
+			return max
+		}
+	}
+	if d > max {
+		return max
+	}
+	return d
+}
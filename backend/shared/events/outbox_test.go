@@ -0,0 +1,137 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/nats-io/nats.go"
+)
+
+// recordingJetStream records published subjects and fails for selected ones
+type recordingJetStream struct {
+	nats.JetStreamContext
+	subjects []string
+	fail     map[string]bool
+}
+
+func (m *recordingJetStream) PublishMsg(msg *nats.Msg, opts ...nats.PubOpt) (*nats.PubAck, error) {
+	if m.fail[msg.Subject] {
+		return nil, errors.New("publish failed")
+	}
+	m.subjects = append(m.subjects, msg.Subject)
+	return &nats.PubAck{}, nil
+}
+
+func TestOutbox_Add(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO event_outbox").
+		WithArgs(sqlmock.AnyArg(), "user-1", "user.created", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	outbox := NewOutbox(db, NewPublisher(NewJetStreamBroker(&recordingJetStream{}), "test-service"))
+
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := outbox.Add(ctx, tx, "user-1", Event[any]{Type: "user.created"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOutbox_Relay(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"id", "event_id", "aggregate_id", "event_type", "payload", "attempts"}).
+		AddRow(1, "e1", "a", "fail.event", []byte(`{}`), 0).
+		AddRow(2, "e2", "a", "ok.event", []byte(`{}`), 0).
+		AddRow(3, "e3", "b", "ok.event", []byte(`{}`), 0)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT pg_try_advisory_xact_lock").WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+	mock.ExpectQuery("SELECT (.+) FROM event_outbox").WillReturnRows(rows)
+	mock.ExpectExec("UPDATE event_outbox SET attempts").WithArgs("publish failed", sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE event_outbox SET published_at").WithArgs(sqlmock.AnyArg(), 3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	js := &recordingJetStream{fail: map[string]bool{"fail.event": true}}
+	outbox := NewOutbox(db, NewPublisher(NewJetStreamBroker(js), "test-service"))
+
+	n, err := outbox.Relay(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("Want 1 published event, got %d", n)
+	}
+	// e2 must be held back behind the failed e1 of the same aggregate
+	if len(js.subjects) != 1 {
+		t.Errorf("Want 1 publish, got %v", js.subjects)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOutbox_Prune(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec("DELETE FROM event_outbox WHERE published_at < \\$1").WithArgs(sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 5))
+
+	outbox := NewOutbox(db, nil)
+	n, err := outbox.Prune(context.Background(), 7*24*time.Hour)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if n != 5 {
+		t.Errorf("Want 5 pruned events, got %d", n)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{10, 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := backoff(tt.attempt, time.Second, 10*time.Second); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
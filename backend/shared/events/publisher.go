@@ -3,47 +3,328 @@ package events
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/SteinerLabs/lms/backend/shared/trace"
 	"github.com/google/uuid"
 	"github.com/nats-io/nats.go"
 )
 
+// Message headers carrying event metadata, so that consumers and operators
+// can route and filter messages without decoding them
+const (
+	EventTypeHeader     = "Event-Type"
+	SchemaVersionHeader = "Event-Schema-Version"
+	TenantHeader        = "Event-Tenant"
+	ActorHeader         = "Event-Actor"
+)
+
 type Publisher struct {
-	js     nats.JetStreamContext
-	source string // Example: auth-service
+	broker    Broker
+	source    string // Example: auth-service
+	registry  *Registry
+	codec     Codec
+	validate  bool
+	tenants   bool
+	scheduler *Scheduler
+	metrics   *Metrics
+}
+
+// PublisherOption configures optional Publisher behaviour
+type PublisherOption func(*Publisher)
+
+// WithPublisherRegistry sets the registry used to stamp the schema version of
+// published events and to validate them. It defaults to DefaultRegistry.
+func WithPublisherRegistry(r *Registry) PublisherOption {
+	return func(p *Publisher) {
+		p.registry = r
+	}
+}
+
+// WithPublishValidation rejects events that do not match the JSON Schema of
+// their type with ErrInvalidEvent instead of publishing them
+func WithPublishValidation() PublisherOption {
+	return func(p *Publisher) {
+		p.validate = true
+	}
+}
+
+// WithPublisherCodec sets the codec events are encoded with. It defaults to
+// JSONCodec.
+func WithPublisherCodec(codec Codec) PublisherOption {
+	return func(p *Publisher) {
+		p.codec = codec
+	}
+}
+
+// WithTenantSubjects publishes events of a tenant to <tenant>.<type> instead
+// of <type>, so that streams and consumers can be scoped to tenants. Events
+// without a tenant keep their type as subject. The streams of DefaultTopology
+// do not capture tenant subjects; declare streams such as *.course.> instead.
+func WithTenantSubjects() PublisherOption {
+	return func(p *Publisher) {
+		p.tenants = true
+	}
+}
+
+// WithPublisherMetrics reports publish latency and failures to m. It
+// defaults to DefaultMetrics.
+func WithPublisherMetrics(m *Metrics) PublisherOption {
+	return func(p *Publisher) {
+		p.metrics = m
+	}
+}
+
+func NewPublisher(broker Broker, source string, opts ...PublisherOption) *Publisher {
+	p := &Publisher{
+		broker:   broker,
+		source:   source,
+		registry: DefaultRegistry,
+		codec:    JSONCodec{},
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.metrics == nil {
+		p.metrics = DefaultMetrics()
+	}
+	return p
+}
+
+// PublishOption configures a single publish
+type PublishOption func(*publishOptions)
+
+type publishOptions struct {
+	expectLastSeq *uint64
+}
+
+// WithExpectedLastSequence rejects the publish unless the last message on the
+// event's subject has sequence seq. Use 0 to require that the subject is
+// still empty. This gives optimistic concurrency per subject.
+func WithExpectedLastSequence(seq uint64) PublishOption {
+	return func(o *publishOptions) {
+		o.expectLastSeq = &seq
+	}
+}
+
+// PublishResult is the outcome of publishing one event of a batch
+type PublishResult struct {
+	EventID   string
+	Stream    string
+	Sequence  uint64
+	Duplicate bool // The stream already held a message with this event ID
+	Err       error
+}
+
+// Publish publishes event. The event ID is used as the JetStream message ID,
+// so retrying a publish within the stream's duplicate window is safe.
+func (p *Publisher) Publish(ctx context.Context, event Event[any], opts ...PublishOption) error {
+	_, err := p.PublishWithAck(ctx, event, opts...)
+	return err
+}
+
+// PublishWithAck publishes event and returns the stream's acknowledgement
+func (p *Publisher) PublishWithAck(ctx context.Context, event Event[any], opts ...PublishOption) (*nats.PubAck, error) {
+	p.enrich(ctx, &event)
+
+	payload, err := p.encode(event)
+	if err != nil {
+		return nil, err
+	}
+	return p.send(ctx, event, p.codec.ContentType(), payload, opts...)
+}
+
+// PublishAt stores event to be published at t and returns its ID, which can
+// be passed to Scheduler.Cancel. It requires WithScheduler.
+func (p *Publisher) PublishAt(ctx context.Context, event Event[any], t time.Time) (string, error) {
+	if p.scheduler == nil {
+		return "", ErrNoScheduler
+	}
+	return p.scheduler.Schedule(ctx, event, t)
+}
+
+// PublishAfter stores event to be published after d and returns its ID. It
+// requires WithScheduler.
+func (p *Publisher) PublishAfter(ctx context.Context, event Event[any], d time.Duration) (string, error) {
+	return p.PublishAt(ctx, event, time.Now().Add(d))
 }
 
-func NewPublisher(js nats.JetStreamContext, source string) *Publisher {
-	return &Publisher{
-		js:     js,
-		source: source,
+// Scheduler returns the scheduler enabled by WithScheduler, or nil
+func (p *Publisher) Scheduler() *Scheduler {
+	return p.scheduler
+}
+
+// PublishBatch publishes events asynchronously and waits for all of them to
+// be acknowledged. Failures are reported per event; the returned error is only
+// set when ctx ends before every acknowledgement arrived.
+func (p *Publisher) PublishBatch(ctx context.Context, events []Event[any]) ([]PublishResult, error) {
+	results := make([]PublishResult, len(events))
+	futures := make([]nats.PubAckFuture, len(events))
+	types := make([]string, len(events))
+	start := time.Now()
+
+	for i, event := range events {
+		p.enrich(ctx, &event)
+		results[i].EventID = event.ID
+		types[i] = event.Type
+
+		payload, err := p.encode(event)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		futures[i], err = p.broker.PublishAsync(p.message(event, p.codec.ContentType(), payload, publishOptions{}))
+		if err != nil {
+			results[i].Err = err
+			p.metrics.published(event.Type, start, err)
+		}
+	}
+
+	for i, future := range futures {
+		if future == nil {
+			continue
+		}
+		select {
+		case ack := <-future.Ok():
+			results[i].Stream = ack.Stream
+			results[i].Sequence = ack.Sequence
+			results[i].Duplicate = ack.Duplicate
+			p.metrics.published(types[i], start, nil)
+		case err := <-future.Err():
+			results[i].Err = err
+			p.metrics.published(types[i], start, err)
+		case <-ctx.Done():
+			return results, fmt.Errorf("failed to wait for publish acks: %w", ctx.Err())
+		}
 	}
+	return results, nil
+}
+
+// encode encodes event with the publisher's codec and validates it when
+// validation is enabled
+func (p *Publisher) encode(event Event[any]) ([]byte, error) {
+	payload, err := p.codec.Encode(event)
+	if err != nil {
+		return nil, err
+	}
+	if p.validate {
+		// Schemas describe the JSON encoding
+		encoded := payload
+		if p.codec.ContentType() != ContentTypeJSON {
+			if encoded, err = json.Marshal(event); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.registry.Validate(encoded); err != nil {
+			return nil, err
+		}
+	}
+	return payload, nil
+}
+
+// marshal encodes event as JSON, the form in which outbox and scheduled events
+// are stored, and validates it when validation is enabled
+func (p *Publisher) marshal(event Event[any]) ([]byte, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event: %w", err)
+	}
+	if p.validate {
+		if err := p.registry.Validate(payload); err != nil {
+			return nil, err
+		}
+	}
+	return payload, nil
+}
+
+// enrich fills the ID, schema version, tracing fields, tenant, actor and
+// source of event. Events published while handling another event are caused
+// by it; otherwise the trace of the surrounding web request is used, or a new
+// trace is started.
+func (p *Publisher) enrich(ctx context.Context, event *Event[any]) {
+	enrich(ctx, event, p.source, p.registry)
 }
 
-func (p *Publisher) Publish(ctx context.Context, event Event[any]) error {
+func enrich(ctx context.Context, event *Event[any], source string, registry *Registry) {
 	traceID := TraceIDFromContext(ctx)
-	if traceID != "" {
-		traceID = uuid.New().String()
+	if traceID == "" {
+		traceID = trace.NewTraceID()
 	}
 
-	correlationID := traceID
-	if v := ctx.Value(ctxCorrelationIDKey); v != nil {
-		correlationID = v.(string)
+	correlationID := stringFromContext(ctx, ctxCorrelationIDKey)
+	if correlationID == "" {
+		correlationID = traceID
 	}
 
-	causationID := correlationID
-	if v := ctx.Value(ctxCausationIDKey); v != nil {
-		causationID = v.(string)
+	causationID := stringFromContext(ctx, ctxEventIDKey)
+	if causationID == "" {
+		causationID = correlationID
 	}
 
+	if event.ID == "" {
+		event.ID = uuid.New().String()
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now().UTC()
+	}
+	if event.SchemaVersion == 0 {
+		event.SchemaVersion = registry.Version(event.Type)
+	}
+	if event.TenantID == "" {
+		event.TenantID = TenantIDFromContext(ctx)
+	}
+	if event.ActorID == "" {
+		event.ActorID = ActorIDFromContext(ctx)
+	}
 	event.TraceID = traceID
 	event.CorrelationID = correlationID
 	event.CausationID = causationID
-	event.Source = p.source
+	event.Source = source
+}
 
-	payload, err := json.Marshal(event)
-	if err != nil {
-		return err
+// send publishes an already encoded event to its subject
+func (p *Publisher) send(ctx context.Context, event Event[any], contentType string, payload []byte, opts ...PublishOption) (*nats.PubAck, error) {
+	var o publishOptions
+	for _, opt := range opts {
+		opt(&o)
 	}
-	_, err = p.js.Publish(event.Type, payload)
-	return err
+
+	start := time.Now()
+	ack, err := p.broker.Publish(ctx, p.message(event, contentType, payload, o))
+	p.metrics.published(event.Type, start, err)
+	return ack, err
+}
+
+func (p *Publisher) message(event Event[any], contentType string, payload []byte, o publishOptions) *nats.Msg {
+	msg := nats.NewMsg(p.subject(event))
+	msg.Data = payload
+	msg.Header.Set(nats.MsgIdHdr, event.ID)
+	msg.Header.Set(ContentTypeHeader, contentType)
+	msg.Header.Set(EventTypeHeader, event.Type)
+	if event.SchemaVersion > 0 {
+		msg.Header.Set(SchemaVersionHeader, strconv.Itoa(event.SchemaVersion))
+	}
+	if event.TenantID != "" {
+		msg.Header.Set(TenantHeader, event.TenantID)
+	}
+	if event.ActorID != "" {
+		msg.Header.Set(ActorHeader, event.ActorID)
+	}
+	if traceparent := trace.FormatTraceparent(event.TraceID); traceparent != "" {
+		msg.Header.Set(trace.TraceparentHeader, traceparent)
+	}
+	if o.expectLastSeq != nil {
+		msg.Header.Set(nats.ExpectedLastSubjSeqHdr, strconv.FormatUint(*o.expectLastSeq, 10))
+	}
+	return msg
+}
+
+// subject returns the subject event is published to
+func (p *Publisher) subject(event Event[any]) string {
+	if p.tenants && event.TenantID != "" {
+		return event.TenantID + "." + event.Type
+	}
+	return event.Type
 }
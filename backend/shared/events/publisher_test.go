@@ -2,15 +2,68 @@ package events
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
 
+	"github.com/SteinerLabs/lms/backend/shared/log"
+	"github.com/SteinerLabs/lms/backend/shared/trace"
+	"github.com/SteinerLabs/lms/backend/shared/web"
 	"github.com/nats-io/nats.go"
 )
 
 // mockJetStream implements a mock NATS JetStream for testing
 type mockJetStream struct {
 	nats.JetStreamContext
-	messages chan *nats.Msg
+	messages  chan *nats.Msg
+	published chan *nats.Msg
+
+	mu        sync.Mutex
+	consumers map[string]nats.ConsumerConfig
+	deleted   []string
+
+	// Whether a durable existed when each subscription was made
+	boundExisting []bool
+}
+
+func (m *mockJetStream) StreamNameBySubject(subject string, opts ...nats.JSOpt) (string, error) {
+	return "TEST", nil
+}
+
+func (m *mockJetStream) ConsumerInfo(stream string, name string, opts ...nats.JSOpt) (*nats.ConsumerInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cfg, ok := m.consumers[name]
+	if !ok {
+		return nil, nats.ErrConsumerNotFound
+	}
+	return &nats.ConsumerInfo{Stream: stream, Name: name, Config: cfg}, nil
+}
+
+func (m *mockJetStream) AddConsumer(stream string, cfg *nats.ConsumerConfig, opts ...nats.JSOpt) (*nats.ConsumerInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.consumers == nil {
+		m.consumers = make(map[string]nats.ConsumerConfig)
+	}
+	m.consumers[cfg.Durable] = *cfg
+	return &nats.ConsumerInfo{Stream: stream, Name: cfg.Durable, Config: *cfg}, nil
+}
+
+func (m *mockJetStream) UpdateConsumer(stream string, cfg *nats.ConsumerConfig, opts ...nats.JSOpt) (*nats.ConsumerInfo, error) {
+	return m.AddConsumer(stream, cfg, opts...)
+}
+
+func (m *mockJetStream) DeleteConsumer(stream string, name string, opts ...nats.JSOpt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.consumers, name)
+	m.deleted = append(m.deleted, name)
+	return nil
 }
 
 func (m *mockJetStream) Publish(subject string, data []byte, opts ...nats.PubOpt) (*nats.PubAck, error) {
@@ -21,7 +74,15 @@ func (m *mockJetStream) Publish(subject string, data []byte, opts ...nats.PubOpt
 	return &nats.PubAck{}, nil
 }
 
+func (m *mockJetStream) PublishMsg(msg *nats.Msg, opts ...nats.PubOpt) (*nats.PubAck, error) {
+	m.published <- msg
+	return &nats.PubAck{}, nil
+}
+
 func (m *mockJetStream) Subscribe(subject string, cb nats.MsgHandler, opts ...nats.SubOpt) (*nats.Subscription, error) {
+	m.mu.Lock()
+	m.boundExisting = append(m.boundExisting, len(m.consumers) > 0)
+	m.mu.Unlock()
 	go func() {
 		for msg := range m.messages {
 			cb(msg)
@@ -32,10 +93,10 @@ func (m *mockJetStream) Subscribe(subject string, cb nats.MsgHandler, opts ...na
 
 func TestPublisher_Publish(t *testing.T) {
 	js := &mockJetStream{
-		messages: make(chan *nats.Msg, 1),
+		published: make(chan *nats.Msg, 1),
 	}
 
-	publisher := NewPublisher(js, "test-service")
+	publisher := NewPublisher(NewJetStreamBroker(js), "test-service")
 
 	type testData struct {
 		Message string `json:"message"`
@@ -52,11 +113,233 @@ func TestPublisher_Publish(t *testing.T) {
 		t.Fatalf("Unexpected error: %v", err)
 	}
 
-	if len(js.messages) != 1 {
-		t.Errorf("Expected 1 published message, got %d", len(js.messages))
+	if len(js.published) != 1 {
+		t.Fatalf("Expected 1 published message, got %d", len(js.published))
 	}
 
-	if message := <-js.messages; message.Subject != "test.event" {
+	message := <-js.published
+	if message.Subject != "test.event" {
 		t.Error("Expected message to be published to 'test.event'")
 	}
+
+	var published Event[any]
+	if err := json.Unmarshal(message.Data, &published); err != nil {
+		t.Fatal(err)
+	}
+	if published.ID == "" || message.Header.Get(nats.MsgIdHdr) != published.ID {
+		t.Errorf("Expected event ID %q as message ID, got %q", published.ID, message.Header.Get(nats.MsgIdHdr))
+	}
+	if published.SchemaVersion != 1 {
+		t.Errorf("Expected schema version 1, got %d", published.SchemaVersion)
+	}
+}
+
+func TestPublisher_PublishExpectedLastSequence(t *testing.T) {
+	js := &mockJetStream{
+		published: make(chan *nats.Msg, 1),
+	}
+
+	err := NewPublisher(NewJetStreamBroker(js), "test-service").Publish(context.Background(), Event[any]{ID: "e1", Type: "course.updated"}, WithExpectedLastSequence(42))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	message := <-js.published
+	if got := message.Header.Get(nats.ExpectedLastSubjSeqHdr); got != "42" {
+		t.Errorf("Want expected last sequence 42, got %q", got)
+	}
+	if got := message.Header.Get(nats.MsgIdHdr); got != "e1" {
+		t.Errorf("Want message ID e1, got %q", got)
+	}
+}
+
+// asyncJetStream acknowledges async publishes immediately, assigning stream
+// sequences and failing for selected subjects
+type asyncJetStream struct {
+	nats.JetStreamContext
+	seq  uint64
+	ids  map[string]uint64
+	fail map[string]bool
+}
+
+type pubAckFuture struct {
+	msg *nats.Msg
+	ok  chan *nats.PubAck
+	err chan error
+}
+
+func (f *pubAckFuture) Ok() <-chan *nats.PubAck { return f.ok }
+func (f *pubAckFuture) Err() <-chan error       { return f.err }
+func (f *pubAckFuture) Msg() *nats.Msg          { return f.msg }
+
+func (m *asyncJetStream) PublishMsgAsync(msg *nats.Msg, opts ...nats.PubOpt) (nats.PubAckFuture, error) {
+	f := &pubAckFuture{msg: msg, ok: make(chan *nats.PubAck, 1), err: make(chan error, 1)}
+	if m.fail[msg.Subject] {
+		f.err <- errors.New("publish failed")
+		return f, nil
+	}
+
+	id := msg.Header.Get(nats.MsgIdHdr)
+	if seq, ok := m.ids[id]; ok {
+		f.ok <- &nats.PubAck{Stream: "TEST", Sequence: seq, Duplicate: true}
+		return f, nil
+	}
+	m.seq++
+	m.ids[id] = m.seq
+	f.ok <- &nats.PubAck{Stream: "TEST", Sequence: m.seq}
+	return f, nil
+}
+
+func TestPublisher_PublishBatch(t *testing.T) {
+	js := &asyncJetStream{
+		ids:  map[string]uint64{"e1": 1},
+		seq:  1,
+		fail: map[string]bool{"billing.payment.failed": true},
+	}
+
+	results, err := NewPublisher(NewJetStreamBroker(js), "test-service").PublishBatch(context.Background(), []Event[any]{
+		{ID: "e1", Type: "user.created"},
+		{ID: "e2", Type: "user.updated"},
+		{ID: "e3", Type: "billing.payment.failed"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := []PublishResult{
+		{EventID: "e1", Stream: "TEST", Sequence: 1, Duplicate: true},
+		{EventID: "e2", Stream: "TEST", Sequence: 2},
+		{EventID: "e3"},
+	}
+	for i, w := range want {
+		got := results[i]
+		if got.EventID != w.EventID || got.Stream != w.Stream || got.Sequence != w.Sequence || got.Duplicate != w.Duplicate {
+			t.Errorf("Result %d: want %+v, got %+v", i, w, got)
+		}
+	}
+	if results[1].Err != nil || results[2].Err == nil {
+		t.Errorf("Want only the third publish to fail, got %v, %v", results[1].Err, results[2].Err)
+	}
+}
+
+func TestPublisher_PublishPropagatesTrace(t *testing.T) {
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	consumed := Event[any]{ID: "consumed-1", TraceID: traceID, CorrelationID: "corr-1", CausationID: "root"}
+	tests := []struct {
+		name            string
+		ctx             context.Context
+		wantTrace       string
+		wantCorrelation string
+		wantCausation   string
+	}{
+		{"from consumed event", WithEventContext(context.Background(), consumed), traceID, "corr-1", "consumed-1"},
+		{"new trace", context.Background(), "", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			js := &mockJetStream{
+				published: make(chan *nats.Msg, 1),
+			}
+			if err := NewPublisher(NewJetStreamBroker(js), "test-service").Publish(tt.ctx, Event[any]{Type: "progress.updated"}); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			message := <-js.published
+			var published Event[any]
+			if err := json.Unmarshal(message.Data, &published); err != nil {
+				t.Fatal(err)
+			}
+
+			if published.TraceID == "" || (tt.wantTrace != "" && published.TraceID != tt.wantTrace) {
+				t.Errorf("Want trace %q, got %q", tt.wantTrace, published.TraceID)
+			}
+			if tt.wantCorrelation != "" && published.CorrelationID != tt.wantCorrelation {
+				t.Errorf("Want correlation %q, got %q", tt.wantCorrelation, published.CorrelationID)
+			}
+			if tt.wantCausation != "" && published.CausationID != tt.wantCausation {
+				t.Errorf("Want causation %q, got %q", tt.wantCausation, published.CausationID)
+			}
+
+			got, ok := trace.ParseTraceparent(message.Header.Get(trace.TraceparentHeader))
+			if !ok || got != published.TraceID {
+				t.Errorf("Want traceparent for trace %q, got %q", published.TraceID, message.Header.Get(trace.TraceparentHeader))
+			}
+		})
+	}
+}
+
+func TestPublisher_PublishFromWebRequest(t *testing.T) {
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	js := &mockJetStream{
+		published: make(chan *nats.Msg, 1),
+	}
+	publisher := NewPublisher(NewJetStreamBroker(js), "test-service")
+
+	app := web.NewApp(log.New(log.WithOutput(io.Discard)))
+	app.Post("", "/courses", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		return publisher.Publish(ctx, Event[any]{Type: "course.created"})
+	})
+
+	r := httptest.NewRequest(http.MethodPost, "/courses", nil)
+	r.Header.Set(trace.TraceparentHeader, traceparent)
+	app.ServeHTTP(httptest.NewRecorder(), r)
+
+	message := <-js.published
+	var published Event[any]
+	if err := json.Unmarshal(message.Data, &published); err != nil {
+		t.Fatal(err)
+	}
+	if published.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Want trace ID of the request, got %q", published.TraceID)
+	}
+}
+
+func TestPublisher_TenantSubjects(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        []PublisherOption
+		tenant      string
+		wantSubject string
+	}{
+		{"tenant subjects", []PublisherOption{WithTenantSubjects()}, "acme", "acme.course.updated"},
+		{"no tenant", []PublisherOption{WithTenantSubjects()}, "", "course.updated"},
+		{"type subjects", nil, "acme", "course.updated"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			js := &mockJetStream{
+				published: make(chan *nats.Msg, 1),
+			}
+			ctx := WithActorID(WithTenantID(context.Background(), tt.tenant), "u1")
+			if err := NewPublisher(NewJetStreamBroker(js), "test-service", tt.opts...).Publish(ctx, Event[any]{Type: "course.updated"}); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			message := <-js.published
+			if message.Subject != tt.wantSubject {
+				t.Errorf("Want subject %q, got %q", tt.wantSubject, message.Subject)
+			}
+			if got := message.Header.Get(TenantHeader); got != tt.tenant {
+				t.Errorf("Want tenant header %q, got %q", tt.tenant, got)
+			}
+			if got := message.Header.Get(ActorHeader); got != "u1" {
+				t.Errorf("Want actor header %q, got %q", "u1", got)
+			}
+			if got := message.Header.Get(EventTypeHeader); got != "course.updated" {
+				t.Errorf("Want type header %q, got %q", "course.updated", got)
+			}
+
+			var published Event[any]
+			if err := json.Unmarshal(message.Data, &published); err != nil {
+				t.Fatal(err)
+			}
+			if published.TenantID != tt.tenant || published.ActorID != "u1" {
+				t.Errorf("Want tenant %q and actor u1, got %q and %q", tt.tenant, published.TenantID, published.ActorID)
+			}
+		})
+	}
 }
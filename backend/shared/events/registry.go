@@ -0,0 +1,288 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// ErrDecode is returned when an event payload cannot be decoded into the
+// payload type registered for its event type.
+var ErrDecode = errors.New("event decode failed")
+
+// Registry maps event type strings to the Go payload structs they carry and
+// to the upcasters that migrate older payload versions to those structs.
+type Registry struct {
+	mu        sync.RWMutex
+	types     map[string]reflect.Type
+	versions  map[string]int
+	upcasters map[string]map[int]Upcaster
+}
+
+// Upcaster migrates the JSON payload of an event from one schema version to
+// the next
+type Upcaster func(data json.RawMessage) (json.RawMessage, error)
+
+// DefaultRegistry contains every payload struct declared in this package.
+var DefaultRegistry = newDefaultRegistry()
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		types:     make(map[string]reflect.Type),
+		versions:  make(map[string]int),
+		upcasters: make(map[string]map[int]Upcaster),
+	}
+}
+
+func newDefaultRegistry() *Registry {
+	r := NewRegistry()
+	registerPayloads(r)
+	return r
+}
+
+// Register associates eventType with the payload type T. Registering the same
+// event type twice replaces the previous payload type.
+func Register[T any](r *Registry, eventType string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.types[eventType] = reflect.TypeFor[T]()
+}
+
+// RegisterUpcaster registers upcaster to migrate eventType payloads from
+// version from to version from+1. The current schema version of eventType
+// becomes at least from+1, so publishers stamp new events with it.
+func RegisterUpcaster(r *Registry, eventType string, from int, upcaster Upcaster) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.upcasters[eventType] == nil {
+		r.upcasters[eventType] = make(map[int]Upcaster)
+	}
+	r.upcasters[eventType][from] = upcaster
+	if r.versions[eventType] < from+1 {
+		r.versions[eventType] = from + 1
+	}
+}
+
+// Version returns the current schema version of eventType. Event types
+// without upcasters are at version 1.
+func (r *Registry) Version(eventType string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if v, ok := r.versions[eventType]; ok {
+		return v
+	}
+	return 1
+}
+
+// Lookup returns the payload type registered for eventType
+func (r *Registry) Lookup(eventType string) (reflect.Type, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.types[eventType]
+	return t, ok
+}
+
+// Types returns all registered event types
+func (r *Registry) Types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	types := make([]string, 0, len(r.types))
+	for t := range r.types {
+		types = append(types, t)
+	}
+	return types
+}
+
+// Decode unmarshals an event envelope. When the event type is registered, Data
+// holds a value of the registered payload type; otherwise Data is left as the
+// generic JSON representation. Payloads of older schema versions are upcast
+// to the current version first. Payloads of newer versions are decoded as
+// they are, which works for the additive changes that do not need a bump.
+func (r *Registry) Decode(data []byte) (Event[any], error) {
+	var raw Event[json.RawMessage]
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return Event[any]{}, fmt.Errorf("%w: envelope: %v", ErrDecode, err)
+	}
+	return r.decodeRaw(raw)
+}
+
+// decodeRaw decodes the JSON payload of an envelope whose metadata has
+// already been decoded
+func (r *Registry) decodeRaw(raw Event[json.RawMessage]) (Event[any], error) {
+	e := Event[any]{
+		ID:            raw.ID,
+		TraceID:       raw.TraceID,
+		CorrelationID: raw.CorrelationID,
+		CausationID:   raw.CausationID,
+		Source:        raw.Source,
+		TenantID:      raw.TenantID,
+		ActorID:       raw.ActorID,
+		Type:          raw.Type,
+		SchemaVersion: raw.SchemaVersion,
+		OccurredAt:    raw.OccurredAt,
+	}
+
+	upcast, version, err := r.upcast(raw.Type, raw.SchemaVersion, raw.Data)
+	if err != nil {
+		return e, err
+	}
+	e.SchemaVersion = version
+
+	payload, err := r.decodeData(raw.Type, upcast)
+	if err != nil {
+		return e, err
+	}
+	e.Data = payload
+	return e, nil
+}
+
+// upcast migrates data of the given schema version to the current version of
+// eventType and returns it with the version it ends up at
+func (r *Registry) upcast(eventType string, version int, data json.RawMessage) (json.RawMessage, int, error) {
+	if version == 0 {
+		// Events published before schema versions were introduced
+		version = 1
+	}
+
+	current := r.Version(eventType)
+	for ; version < current; version++ {
+		r.mu.RLock()
+		upcaster, ok := r.upcasters[eventType][version]
+		r.mu.RUnlock()
+		if !ok {
+			return nil, version, fmt.Errorf("%w: %s: no upcaster from version %d", ErrDecode, eventType, version)
+		}
+
+		var err error
+		if data, err = upcaster(data); err != nil {
+			return nil, version, fmt.Errorf("%w: %s: upcast from version %d: %v", ErrDecode, eventType, version, err)
+		}
+	}
+	return data, version, nil
+}
+
+func (r *Registry) decodeData(eventType string, data json.RawMessage) (any, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	t, ok := r.Lookup(eventType)
+	if !ok {
+		var v any
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrDecode, eventType, err)
+		}
+		return v, nil
+	}
+
+	v := reflect.New(t)
+	if err := json.Unmarshal(data, v.Interface()); err != nil {
+		return nil, fmt.Errorf("%w: %s into %s: %v", ErrDecode, eventType, t, err)
+	}
+	return v.Elem().Interface(), nil
+}
+
+// TypedHandlerFunc handles events whose payload is of type T
+type TypedHandlerFunc[T any] func(ctx context.Context, event Event[T]) error
+
+// Typed adapts a TypedHandlerFunc to a HandlerFunc. Payloads that were not
+// decoded into T by the registry are converted through JSON; a payload that
+// does not fit T is reported as ErrDecode instead of reaching the handler.
+func Typed[T any](handler TypedHandlerFunc[T]) HandlerFunc {
+	return func(ctx context.Context, event Event[any]) error {
+		typed, err := As[T](event)
+		if err != nil {
+			return err
+		}
+		return handler(ctx, typed)
+	}
+}
+
+// As converts a generic event into an event with a payload of type T
+func As[T any](event Event[any]) (Event[T], error) {
+	typed := Event[T]{
+		ID:            event.ID,
+		TraceID:       event.TraceID,
+		CorrelationID: event.CorrelationID,
+		CausationID:   event.CausationID,
+		Source:        event.Source,
+		TenantID:      event.TenantID,
+		ActorID:       event.ActorID,
+		Type:          event.Type,
+		SchemaVersion: event.SchemaVersion,
+		OccurredAt:    event.OccurredAt,
+	}
+
+	switch data := event.Data.(type) {
+	case T:
+		typed.Data = data
+	case *T:
+		if data != nil {
+			typed.Data = *data
+		}
+	case nil:
+	default:
+		b, err := json.Marshal(data)
+		if err != nil {
+			return typed, fmt.Errorf("%w: %s: %v", ErrDecode, event.Type, err)
+		}
+		if err := json.Unmarshal(b, &typed.Data); err != nil {
+			return typed, fmt.Errorf("%w: %s into %T: %v", ErrDecode, event.Type, typed.Data, err)
+		}
+	}
+	return typed, nil
+}
+
+// StartTyped starts the consumer with a handler for payloads of type T
+func StartTyped[T any](ctx context.Context, c *Consumer, handler TypedHandlerFunc[T]) error {
+	return c.Start(ctx, Typed(handler))
+}
+
+// Router dispatches events to handlers by event type. It is intended for
+// consumers subscribed to wildcard subjects such as "course.>".
+type Router struct {
+	mu       sync.RWMutex
+	handlers map[string]HandlerFunc
+	fallback HandlerFunc
+}
+
+// NewRouter creates an empty router
+func NewRouter() *Router {
+	return &Router{
+		handlers: make(map[string]HandlerFunc),
+	}
+}
+
+// Route registers a typed handler for eventType on the router
+func Route[T any](r *Router, eventType string, handler TypedHandlerFunc[T]) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[eventType] = Typed(handler)
+}
+
+// Fallback sets the handler for event types without a route. Without a
+// fallback such events are acknowledged and ignored.
+func (r *Router) Fallback(handler HandlerFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fallback = handler
+}
+
+// Handle implements HandlerFunc
+func (r *Router) Handle(ctx context.Context, event Event[any]) error {
+	r.mu.RLock()
+	handler, ok := r.handlers[event.Type]
+	if !ok {
+		handler = r.fallback
+	}
+	r.mu.RUnlock()
+
+	if handler == nil {
+		return nil
+	}
+	return handler(ctx, event)
+}
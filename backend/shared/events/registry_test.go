@@ -0,0 +1,191 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestRegistry_Decode(t *testing.T) {
+	registry := NewRegistry()
+	Register[UserCreatedEvent](registry, TypeUserCreated)
+
+	tests := []struct {
+		name     string
+		payload  string
+		wantErr  bool
+		wantType string
+	}{
+		{
+			name:     "registered type",
+			payload:  `{"id":"1","type":"user.created","data":{"id":"u1","email":"user@example.com"}}`,
+			wantType: "events.UserCreatedEvent",
+		},
+		{
+			name:     "unregistered type",
+			payload:  `{"id":"2","type":"unknown.event","data":{"id":"u1"}}`,
+			wantType: "map[string]interface {}",
+		},
+		{
+			name:    "mismatched payload",
+			payload: `{"id":"3","type":"user.created","data":{"id":42}}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid envelope",
+			payload: `{"id":`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := registry.Decode([]byte(tt.payload))
+			if tt.wantErr {
+				if !errors.Is(err, ErrDecode) {
+					t.Fatalf("Want ErrDecode, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := typeName(event.Data); got != tt.wantType {
+				t.Errorf("Want data type %q, got %q", tt.wantType, got)
+			}
+		})
+	}
+}
+
+func TestRegistry_Upcast(t *testing.T) {
+	type profileV3 struct {
+		Email    string `json:"email"`
+		FullName string `json:"full_name"`
+	}
+
+	registry := NewRegistry()
+	Register[profileV3](registry, "user.profile")
+	// v1 -> v2 renamed mail to email, v2 -> v3 merged the name fields
+	RegisterUpcaster(registry, "user.profile", 1, func(data json.RawMessage) (json.RawMessage, error) {
+		var v map[string]any
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+		v["email"] = v["mail"]
+		delete(v, "mail")
+		return json.Marshal(v)
+	})
+	RegisterUpcaster(registry, "user.profile", 2, func(data json.RawMessage) (json.RawMessage, error) {
+		var v map[string]any
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+		v["full_name"] = fmt.Sprintf("%s %s", v["first_name"], v["last_name"])
+		return json.Marshal(v)
+	})
+
+	if got := registry.Version("user.profile"); got != 3 {
+		t.Fatalf("Want current version 3, got %d", got)
+	}
+
+	want := profileV3{Email: "ada@example.com", FullName: "Ada Lovelace"}
+	payloads := map[string]string{
+		"unversioned": `{"type":"user.profile","data":{"mail":"ada@example.com","first_name":"Ada","last_name":"Lovelace"}}`,
+		"version 2":   `{"type":"user.profile","schema_version":2,"data":{"email":"ada@example.com","first_name":"Ada","last_name":"Lovelace"}}`,
+		"current":     `{"type":"user.profile","schema_version":3,"data":{"email":"ada@example.com","full_name":"Ada Lovelace"}}`,
+	}
+	for name, payload := range payloads {
+		t.Run(name, func(t *testing.T) {
+			event, err := registry.Decode([]byte(payload))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if event.SchemaVersion != 3 || event.Data != want {
+				t.Errorf("Want %+v at version 3, got %+v at version %d", want, event.Data, event.SchemaVersion)
+			}
+		})
+	}
+
+	// A gap in the upcaster chain cannot be decoded
+	Register[profileV3](registry, "user.settings")
+	RegisterUpcaster(registry, "user.settings", 2, func(data json.RawMessage) (json.RawMessage, error) { return data, nil })
+	if _, err := registry.Decode([]byte(`{"type":"user.settings","data":{}}`)); !errors.Is(err, ErrDecode) {
+		t.Errorf("Want ErrDecode for missing upcaster, got %v", err)
+	}
+}
+
+func TestDefaultRegistry(t *testing.T) {
+	for _, eventType := range []string{TypeUserCreated, TypeUserEnrolled, TypePaymentCompleted, TypeNotificationRead} {
+		if _, ok := DefaultRegistry.Lookup(eventType); !ok {
+			t.Errorf("Expected %q to be registered", eventType)
+		}
+	}
+}
+
+func TestTyped(t *testing.T) {
+	var got Event[UserCreatedEvent]
+	handler := Typed(func(ctx context.Context, event Event[UserCreatedEvent]) error {
+		got = event
+		return nil
+	})
+
+	// Payload decoded by the registry
+	event := Event[any]{ID: "1", Type: TypeUserCreated, Data: UserCreatedEvent{Email: "user@example.com"}}
+	if err := handler(context.Background(), event); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got.Data.Email != "user@example.com" || got.ID != "1" {
+		t.Errorf("Unexpected event %+v", got)
+	}
+
+	// Generic payload from an unregistered type
+	var generic any
+	_ = json.Unmarshal([]byte(`{"email":"other@example.com"}`), &generic)
+	if err := handler(context.Background(), Event[any]{Data: generic}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got.Data.Email != "other@example.com" {
+		t.Errorf("Want email %q, got %q", "other@example.com", got.Data.Email)
+	}
+
+	// Payload that does not fit the handler's type
+	err := handler(context.Background(), Event[any]{Data: map[string]any{"email": 42}})
+	if !errors.Is(err, ErrDecode) {
+		t.Errorf("Want ErrDecode, got %v", err)
+	}
+}
+
+func TestRouter(t *testing.T) {
+	router := NewRouter()
+
+	var created, enrolled int
+	Route(router, TypeUserCreated, func(ctx context.Context, event Event[UserCreatedEvent]) error {
+		created++
+		return nil
+	})
+	Route(router, TypeUserEnrolled, func(ctx context.Context, event Event[UserEnrolledEvent]) error {
+		enrolled++
+		return nil
+	})
+
+	ctx := context.Background()
+	_ = router.Handle(ctx, Event[any]{Type: TypeUserCreated, Data: UserCreatedEvent{}})
+	_ = router.Handle(ctx, Event[any]{Type: TypeUserEnrolled, Data: UserEnrolledEvent{}})
+	if err := router.Handle(ctx, Event[any]{Type: "unknown.event"}); err != nil {
+		t.Errorf("Expected unrouted event to be ignored, got %v", err)
+	}
+
+	if created != 1 || enrolled != 1 {
+		t.Errorf("Want 1 created and 1 enrolled, got %d and %d", created, enrolled)
+	}
+}
+
+func typeName(v any) string {
+	if v == nil {
+		return "<nil>"
+	}
+	return reflect.TypeOf(v).String()
+}
@@ -0,0 +1,254 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Replayer feeds the history of a subject through a handler, for example to
+// build a new read model. It reads with an ephemeral ordered consumer, so it
+// leaves no durable state on the server and does not disturb the durable
+// consumers of the subject.
+type Replayer struct {
+	js        nats.JetStreamContext
+	subject   string
+	stream    string
+	registry  *Registry
+	codecs    map[string]Codec
+	startSeq  uint64
+	startTime time.Time
+	types     []string
+	sources   []string
+	rate      float64
+	idle      time.Duration
+	store     IdempotencyStore
+	name      string
+}
+
+// ReplayOption configures optional Replayer behaviour
+type ReplayOption func(*Replayer)
+
+// ReplayStats summarises a replay
+type ReplayStats struct {
+	Read         int    // Messages read from the stream
+	Handled      int    // Events passed to the handler
+	Filtered     int    // Events skipped by the type and source filters
+	Duplicates   int    // Events skipped by the idempotency store
+	Invalid      int    // Messages skipped because they could not be decoded
+	LastSequence uint64 // Stream sequence of the last message read
+}
+
+// WithReplayStream binds the replay to stream instead of looking the stream up
+// by subject
+func WithReplayStream(stream string) ReplayOption {
+	return func(r *Replayer) {
+		r.stream = stream
+	}
+}
+
+// WithReplayFromSequence starts the replay at stream sequence seq
+func WithReplayFromSequence(seq uint64) ReplayOption {
+	return func(r *Replayer) {
+		r.startSeq = seq
+	}
+}
+
+// WithReplayFromTime starts the replay at the first message stored at or
+// after t
+func WithReplayFromTime(t time.Time) ReplayOption {
+	return func(r *Replayer) {
+		r.startTime = t
+	}
+}
+
+// WithReplayTypes only replays events of the given types
+func WithReplayTypes(types ...string) ReplayOption {
+	return func(r *Replayer) {
+		r.types = types
+	}
+}
+
+// WithReplaySources only replays events published by the given sources
+func WithReplaySources(sources ...string) ReplayOption {
+	return func(r *Replayer) {
+		r.sources = sources
+	}
+}
+
+// WithReplayRate limits the replay to perSecond events handled per second
+func WithReplayRate(perSecond float64) ReplayOption {
+	return func(r *Replayer) {
+		r.rate = perSecond
+	}
+}
+
+// WithReplayIdempotency skips events that name already handled according to
+// store, and records the events it handles. Use a name, and preferably a
+// store, that no live consumer uses, so replays and live consumers do not
+// mark each other's events. Without it, every event is handled.
+func WithReplayIdempotency(store IdempotencyStore, name string) ReplayOption {
+	return func(r *Replayer) {
+		r.store = store
+		r.name = name
+	}
+}
+
+// WithReplayRegistry sets the registry used to decode payloads
+func WithReplayRegistry(registry *Registry) ReplayOption {
+	return func(r *Replayer) {
+		r.registry = registry
+	}
+}
+
+// NewReplayer creates a replayer for subject, which may contain wildcards.
+// Without a start option the replay starts at the beginning of the stream.
+func NewReplayer(js nats.JetStreamContext, subject string, opts ...ReplayOption) *Replayer {
+	r := &Replayer{
+		js:       js,
+		subject:  subject,
+		registry: DefaultRegistry,
+		codecs:   defaultCodecs(),
+		idle:     time.Second,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// ReplayIDFromContext returns the ID of the message being replayed as
+// <stream>:<sequence>. Handlers that republish events can use it as the
+// Nats-Msg-Id, so that a restarted replay does not publish them twice.
+func ReplayIDFromContext(ctx context.Context) string {
+	return stringFromContext(ctx, ctxReplayIDKey)
+}
+
+// msgSource is the part of a nats.Subscription the replay reads from
+type msgSource interface {
+	NextMsgWithContext(ctx context.Context) (*nats.Msg, error)
+}
+
+// Run replays events to handler until it has caught up with the stream.
+// Messages that cannot be decoded are logged and skipped. A handler error
+// stops the replay; the returned stats tell where to resume.
+func (r *Replayer) Run(ctx context.Context, handler HandlerFunc) (ReplayStats, error) {
+	opts := []nats.SubOpt{nats.OrderedConsumer()}
+	switch {
+	case r.startSeq > 0:
+		opts = append(opts, nats.StartSequence(r.startSeq))
+	case !r.startTime.IsZero():
+		opts = append(opts, nats.StartTime(r.startTime))
+	default:
+		opts = append(opts, nats.DeliverAll())
+	}
+	if r.stream != "" {
+		opts = append(opts, nats.BindStream(r.stream))
+	}
+
+	sub, err := r.js.SubscribeSync(r.subject, opts...)
+	if err != nil {
+		return ReplayStats{}, fmt.Errorf("failed to subscribe to %s: %w", r.subject, err)
+	}
+	defer sub.Unsubscribe()
+
+	return r.replay(ctx, sub, handler)
+}
+
+func (r *Replayer) replay(ctx context.Context, sub msgSource, handler HandlerFunc) (ReplayStats, error) {
+	var stats ReplayStats
+	var next time.Time
+
+	for {
+		fetchCtx, cancel := context.WithTimeout(ctx, r.idle)
+		msg, err := sub.NextMsgWithContext(fetchCtx)
+		cancel()
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			// Nothing left in the stream
+			return stats, nil
+		}
+		if err != nil {
+			return stats, fmt.Errorf("failed to read message: %w", err)
+		}
+
+		meta, err := msg.Metadata()
+		if err != nil {
+			return stats, fmt.Errorf("failed to read message metadata: %w", err)
+		}
+		stats.Read++
+		stats.LastSequence = meta.Sequence.Stream
+
+		if err := r.handle(ctx, msg, meta, handler, &stats, &next); err != nil {
+			return stats, fmt.Errorf("failed to replay message %d: %w", meta.Sequence.Stream, err)
+		}
+		if meta.NumPending == 0 {
+			return stats, nil
+		}
+	}
+}
+
+// handle decodes, filters and handles one message, waiting for the next slot
+// of the rate limit first
+func (r *Replayer) handle(ctx context.Context, msg *nats.Msg, meta *nats.MsgMetadata, handler HandlerFunc, stats *ReplayStats, next *time.Time) error {
+	e, err := r.decode(msg)
+	if err != nil {
+		log.Printf("Skipping message %d of stream %s: %v", meta.Sequence.Stream, meta.Stream, err)
+		stats.Invalid++
+		return nil
+	}
+
+	if (len(r.types) > 0 && !slices.Contains(r.types, e.Type)) ||
+		(len(r.sources) > 0 && !slices.Contains(r.sources, e.Source)) {
+		stats.Filtered++
+		return nil
+	}
+
+	if r.store != nil {
+		seen, err := r.store.Seen(ctx, r.name, e.ID)
+		if err != nil {
+			return err
+		}
+		if seen {
+			stats.Duplicates++
+			return nil
+		}
+	}
+
+	if r.rate > 0 {
+		if wait := time.Until(*next); wait > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+		*next = time.Now().Add(time.Duration(float64(time.Second) / r.rate))
+	}
+
+	ctx = context.WithValue(WithEventContext(ctx, e), ctxReplayIDKey, fmt.Sprintf("%s:%d", meta.Stream, meta.Sequence.Stream))
+	if err := handler(ctx, e); err != nil {
+		return err
+	}
+	stats.Handled++
+
+	if r.store != nil {
+		if err := r.store.Mark(ctx, r.name, e.ID); err != nil {
+			// The event is handled again by the next replay
+			log.Printf("Failed to mark replayed event %s: %v", e.ID, err)
+		}
+	}
+	return nil
+}
+
+func (r *Replayer) decode(msg *nats.Msg) (Event[any], error) {
+	codec, err := codecFor(r.codecs, msg)
+	if err != nil {
+		return Event[any]{}, err
+	}
+	return codec.Decode(r.registry, msg.Data)
+}
@@ -0,0 +1,145 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// sliceSource returns stored JetStream messages one after another
+type sliceSource struct {
+	msgs []*nats.Msg
+}
+
+func (s *sliceSource) NextMsgWithContext(ctx context.Context) (*nats.Msg, error) {
+	if len(s.msgs) == 0 {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	msg := s.msgs[0]
+	s.msgs = s.msgs[1:]
+	return msg, nil
+}
+
+func newSliceSource(payloads ...string) *sliceSource {
+	s := &sliceSource{}
+	for i, payload := range payloads {
+		seq, pending := i+1, len(payloads)-i-1
+		s.msgs = append(s.msgs, &nats.Msg{
+			Subject: "progress.updated",
+			Reply:   fmt.Sprintf("$JS.ACK.PROGRESS.replay.1.%d.%d.1700000000000000000.%d", seq, seq, pending),
+			Data:    []byte(payload),
+			Sub:     &nats.Subscription{},
+		})
+	}
+	return s
+}
+
+func TestReplayer_Replay(t *testing.T) {
+	store := NewMemoryIdempotencyStore(10)
+	_ = store.Mark(context.Background(), "analytics", "e2")
+
+	replayer := NewReplayer(nil, "progress.>",
+		WithReplayTypes(TypeProgressUpdated, TypeLessonCompleted),
+		WithReplaySources("progress-service"),
+		WithReplayIdempotency(store, "analytics"))
+
+	source := newSliceSource(
+		`{"id":"e1","type":"progress.updated","source":"progress-service"}`,
+		`{"id":"e2","type":"progress.updated","source":"progress-service"}`,
+		`{"id":"e3","type":"progress.quiz.completed","source":"progress-service"}`,
+		`{"id":"e4","type":"progress.lesson.completed","source":"other-service"}`,
+		`{"id":"e5","type":"progress.lesson.completed","source":"progress-service"}`,
+	)
+
+	var handled []string
+	stats, err := replayer.replay(context.Background(), source, func(ctx context.Context, event Event[any]) error {
+		handled = append(handled, event.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := ReplayStats{Read: 5, Handled: 2, Filtered: 2, Duplicates: 1, LastSequence: 5}
+	if stats != want {
+		t.Errorf("Want stats %+v, got %+v", want, stats)
+	}
+	if fmt.Sprint(handled) != "[e1 e5]" {
+		t.Errorf("Want e1 and e5 handled, got %v", handled)
+	}
+	if seen, _ := store.Seen(context.Background(), "analytics", "e5"); !seen {
+		t.Error("Expected replayed event to be marked")
+	}
+}
+
+func TestReplayer_ReplaySkipsInvalid(t *testing.T) {
+	replayer := NewReplayer(nil, "progress.>")
+	source := newSliceSource(
+		`{"id":"e1","type":"progress.updated"}`,
+		`not json`,
+		`{"id":"e3","type":"progress.updated"}`,
+	)
+
+	var ids []string
+	stats, err := replayer.replay(context.Background(), source, func(ctx context.Context, event Event[any]) error {
+		ids = append(ids, ReplayIDFromContext(ctx))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if stats.Handled != 2 || stats.Invalid != 1 || stats.LastSequence != 3 {
+		t.Errorf("Want the invalid message skipped, got %+v", stats)
+	}
+	if fmt.Sprint(ids) != "[PROGRESS:1 PROGRESS:3]" {
+		t.Errorf("Want replay IDs of the stream sequences, got %v", ids)
+	}
+}
+
+func TestReplayer_ReplayStopsOnError(t *testing.T) {
+	replayer := NewReplayer(nil, "progress.>")
+	source := newSliceSource(
+		`{"id":"e1","type":"progress.updated"}`,
+		`{"id":"e2","type":"progress.updated"}`,
+		`{"id":"e3","type":"progress.updated"}`,
+	)
+
+	stats, err := replayer.replay(context.Background(), source, func(ctx context.Context, event Event[any]) error {
+		if event.ID == "e2" {
+			return errors.New("projection failed")
+		}
+		return nil
+	})
+	if err == nil {
+		t.Fatal("Expected replay to fail")
+	}
+	if stats.Handled != 1 || stats.LastSequence != 2 {
+		t.Errorf("Want replay to stop at sequence 2, got %+v", stats)
+	}
+}
+
+func TestReplayer_ReplayRate(t *testing.T) {
+	replayer := NewReplayer(nil, "progress.>", WithReplayRate(50))
+	source := newSliceSource(
+		`{"id":"e1","type":"progress.updated"}`,
+		`{"id":"e2","type":"progress.updated"}`,
+		`{"id":"e3","type":"progress.updated"}`,
+	)
+
+	start := time.Now()
+	_, err := replayer.replay(context.Background(), source, func(ctx context.Context, event Event[any]) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Three events at 50 per second take at least two intervals of 20ms
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("Want replay to be rate limited, took %v", elapsed)
+	}
+}
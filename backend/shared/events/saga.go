@@ -0,0 +1,292 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+)
+
+// SagaStatus is the lifecycle state of a saga instance
+type SagaStatus string
+
+const (
+	SagaRunning      SagaStatus = "running"
+	SagaCompleted    SagaStatus = "completed"
+	SagaCompensating SagaStatus = "compensating"
+	SagaCompensated  SagaStatus = "compensated"
+)
+
+// SagaInstance is one run of a saga, identified by the correlation ID shared
+// by the events of the flow
+type SagaInstance struct {
+	Saga          string
+	CorrelationID string
+	Status        SagaStatus
+	Steps         []string        // Steps handled, in order
+	Compensated   []string        // Steps compensated, in order
+	State         json.RawMessage // JSON encoding of the saga's state type
+	Error         string          // Why the saga is compensating
+	Deadline      time.Time       // When the saga times out or retries compensation; zero if never
+	Version       int             // Incremented by every save
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// SagaStep is a step of a saga, run when an event of type On arrives for a
+// running instance. Handlers run at least once per event, so they should be
+// idempotent.
+type SagaStep[T any] struct {
+	Name string
+	On   string // Event type that triggers the step
+
+	// Handle updates the saga state and may publish the events or commands
+	// that drive the flow on. An error leaves the instance unchanged, so the
+	// event is retried.
+	Handle func(ctx context.Context, state *T, event Event[any]) error
+
+	// Compensate undoes the effects of Handle when the saga is aborted. It
+	// may be nil.
+	Compensate func(ctx context.Context, state *T) error
+
+	// Timeout aborts the saga unless another step runs within Timeout after
+	// this one
+	Timeout time.Duration
+
+	Completes bool // The saga completes after this step
+	Aborts    bool // The event reports a failure; the saga compensates after this step
+}
+
+// Saga coordinates a flow across services. Events of its first step start an
+// instance; events of later steps advance the instance with the same
+// correlation ID and are ignored when there is none. When the saga is
+// aborted, by a step or a timeout, the steps handled so far are compensated
+// in reverse order.
+//
+// Subscribe a consumer to every type in Types and pass Handle as its handler.
+// Run RunTimeouts in one process to enforce step timeouts and to retry failed
+// compensations.
+type Saga[T any] struct {
+	name       string
+	store      SagaStore
+	steps      []SagaStep[T]
+	retryDelay time.Duration
+}
+
+// SagaOption configures optional Saga behaviour
+type SagaOption func(*sagaOptions)
+
+type sagaOptions struct {
+	retryDelay time.Duration
+}
+
+// WithSagaRetryDelay sets how long to wait before retrying a failed
+// compensation. It defaults to one minute.
+func WithSagaRetryDelay(d time.Duration) SagaOption {
+	return func(o *sagaOptions) {
+		o.retryDelay = d
+	}
+}
+
+// NewSaga creates a saga named name that keeps its instances in store. The
+// name also identifies the instances in the store, so it must be unique.
+// Every step must be triggered by a different event type.
+func NewSaga[T any](name string, store SagaStore, steps []SagaStep[T], opts ...SagaOption) (*Saga[T], error) {
+	for i, step := range steps {
+		if j := slices.IndexFunc(steps[:i], func(s SagaStep[T]) bool { return s.On == step.On }); j >= 0 {
+			return nil, fmt.Errorf("saga %s: steps %s and %s are both triggered by %s", name, steps[j].Name, step.Name, step.On)
+		}
+	}
+
+	o := sagaOptions{retryDelay: time.Minute}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Saga[T]{
+		name:       name,
+		store:      store,
+		steps:      steps,
+		retryDelay: o.retryDelay,
+	}, nil
+}
+
+// Types returns the event types the saga reacts to
+func (s *Saga[T]) Types() []string {
+	types := make([]string, len(s.steps))
+	for i, step := range s.steps {
+		types[i] = step.On
+	}
+	return types
+}
+
+// Handle runs the step triggered by event. It is a HandlerFunc.
+func (s *Saga[T]) Handle(ctx context.Context, event Event[any]) error {
+	i := slices.IndexFunc(s.steps, func(step SagaStep[T]) bool { return step.On == event.Type })
+	if i < 0 {
+		return nil
+	}
+	step := s.steps[i]
+	if event.CorrelationID == "" {
+		log.Printf("Ignoring %s event %s without correlation ID in saga %s", event.Type, event.ID, s.name)
+		return nil
+	}
+
+	inst, err := s.store.Load(ctx, s.name, event.CorrelationID)
+	switch {
+	case errors.Is(err, ErrSagaNotFound) && i == 0:
+		inst = &SagaInstance{Saga: s.name, CorrelationID: event.CorrelationID, Status: SagaRunning}
+	case errors.Is(err, ErrSagaNotFound):
+		log.Printf("Ignoring %s event %s for unknown saga %s %s", event.Type, event.ID, s.name, event.CorrelationID)
+		return nil
+	case err != nil:
+		return err
+	}
+	if inst.Status != SagaRunning || slices.Contains(inst.Steps, step.Name) {
+		// Finished, or a redelivery of an event already handled
+		return nil
+	}
+
+	state, err := s.state(inst)
+	if err != nil {
+		return err
+	}
+	if err := step.Handle(ctx, &state, event); err != nil {
+		return fmt.Errorf("failed to run step %s of saga %s: %w", step.Name, s.name, err)
+	}
+
+	inst.Steps = append(inst.Steps, step.Name)
+	inst.Deadline = time.Time{}
+	switch {
+	case step.Aborts:
+		inst.Status = SagaCompensating
+		inst.Error = fmt.Sprintf("aborted by %s event %s", event.Type, event.ID)
+		// Compensation is resumed by RunTimeouts if this process stops
+		inst.Deadline = time.Now().UTC().Add(s.retryDelay)
+	case step.Completes:
+		inst.Status = SagaCompleted
+	case step.Timeout > 0:
+		inst.Deadline = time.Now().UTC().Add(step.Timeout)
+	}
+	if err := s.save(ctx, inst, state); err != nil {
+		return err
+	}
+
+	if inst.Status == SagaCompensating {
+		s.compensate(ctx, inst, &state)
+	}
+	return nil
+}
+
+// CheckTimeouts aborts running instances whose step timed out and retries
+// failed compensations. It returns how many instances it processed.
+func (s *Saga[T]) CheckTimeouts(ctx context.Context) (int, error) {
+	due, err := s.store.Due(ctx, s.name, time.Now().UTC(), 100)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, inst := range due {
+		if err := s.timeout(ctx, inst); err != nil {
+			log.Printf("Failed to time out saga %s %s: %v", s.name, inst.CorrelationID, err)
+		}
+	}
+	return len(due), nil
+}
+
+// timeout aborts inst if it is still running and compensates it
+func (s *Saga[T]) timeout(ctx context.Context, inst *SagaInstance) error {
+	state, err := s.state(inst)
+	if err != nil {
+		return err
+	}
+
+	if inst.Status == SagaRunning {
+		inst.Status = SagaCompensating
+		inst.Error = fmt.Sprintf("timed out after step %s", inst.Steps[len(inst.Steps)-1])
+		inst.Deadline = time.Now().UTC().Add(s.retryDelay)
+		if err := s.save(ctx, inst, state); err != nil {
+			return err
+		}
+	}
+	s.compensate(ctx, inst, &state)
+	return nil
+}
+
+// RunTimeouts checks for timed out instances every interval until ctx is
+// cancelled
+func (s *Saga[T]) RunTimeouts(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.CheckTimeouts(ctx); err != nil {
+			log.Printf("Failed to check timeouts of saga %s: %v", s.name, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// compensate undoes the handled steps of inst in reverse order, saving after
+// every step. A failed compensation is retried by CheckTimeouts after the
+// retry delay.
+func (s *Saga[T]) compensate(ctx context.Context, inst *SagaInstance, state *T) {
+	ctx = WithCorrelationID(ctx, inst.CorrelationID)
+
+	for i := len(inst.Steps) - 1; i >= 0; i-- {
+		name := inst.Steps[i]
+		if slices.Contains(inst.Compensated, name) {
+			continue
+		}
+
+		step := s.steps[slices.IndexFunc(s.steps, func(step SagaStep[T]) bool { return step.Name == name })]
+		if step.Compensate != nil {
+			if err := step.Compensate(ctx, state); err != nil {
+				log.Printf("Failed to compensate step %s of saga %s %s: %v", name, s.name, inst.CorrelationID, err)
+				inst.Deadline = time.Now().UTC().Add(s.retryDelay)
+				if err := s.save(ctx, inst, *state); err != nil {
+					log.Printf("Failed to save compensation of saga %s %s: %v", s.name, inst.CorrelationID, err)
+				}
+				return
+			}
+		}
+
+		inst.Compensated = append(inst.Compensated, name)
+		if i == 0 {
+			inst.Status = SagaCompensated
+			inst.Deadline = time.Time{}
+		}
+		if err := s.save(ctx, inst, *state); err != nil {
+			log.Printf("Failed to save compensation of saga %s %s: %v", s.name, inst.CorrelationID, err)
+			return
+		}
+	}
+}
+
+// state decodes the state of inst
+func (s *Saga[T]) state(inst *SagaInstance) (T, error) {
+	var state T
+	if len(inst.State) > 0 {
+		if err := json.Unmarshal(inst.State, &state); err != nil {
+			return state, fmt.Errorf("failed to decode state of saga %s %s: %w", s.name, inst.CorrelationID, err)
+		}
+	}
+	return state, nil
+}
+
+// save encodes state into inst and stores it
+func (s *Saga[T]) save(ctx context.Context, inst *SagaInstance, state T) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode state of saga %s %s: %w", s.name, inst.CorrelationID, err)
+	}
+	inst.State = data
+	return s.store.Save(ctx, inst)
+}
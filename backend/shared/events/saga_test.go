@@ -0,0 +1,259 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+type enrollmentState struct {
+	CourseID string `json:"course_id"`
+	UserID   string `json:"user_id"`
+	Paid     bool   `json:"paid"`
+}
+
+// enrollmentSaga reserves a course spot, waits for the payment and releases
+// the spot again when the payment fails or does not arrive in time
+func enrollmentSaga(t *testing.T, store SagaStore, released *[]string, timeout time.Duration) *Saga[enrollmentState] {
+	t.Helper()
+	var mu sync.Mutex
+	saga, err := NewSaga("enrollment", store, []SagaStep[enrollmentState]{
+		{
+			Name: "reserve",
+			On:   TypeUserEnrolled,
+			Handle: func(ctx context.Context, state *enrollmentState, event Event[any]) error {
+				enrolled := event.Data.(UserEnrolledEvent)
+				state.CourseID = enrolled.CourseID
+				state.UserID = enrolled.UserID
+				return nil
+			},
+			Compensate: func(ctx context.Context, state *enrollmentState) error {
+				mu.Lock()
+				defer mu.Unlock()
+				*released = append(*released, state.CourseID)
+				return nil
+			},
+			Timeout: timeout,
+		},
+		{
+			Name: "paid",
+			On:   TypePaymentCompleted,
+			Handle: func(ctx context.Context, state *enrollmentState, event Event[any]) error {
+				state.Paid = true
+				return nil
+			},
+			Completes: true,
+		},
+		{
+			Name: "payment-failed",
+			On:   TypePaymentFailed,
+			Handle: func(ctx context.Context, state *enrollmentState, event Event[any]) error {
+				return nil
+			},
+			Aborts: true,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return saga
+}
+
+func sagaEvent(eventType, correlationID string, data any) Event[any] {
+	return Event[any]{ID: eventType + "-1", Type: eventType, CorrelationID: correlationID, Data: data}
+}
+
+func TestSaga_Handle(t *testing.T) {
+	enrolled := UserEnrolledEvent{ID: "en1", CourseID: "c1", UserID: "u1"}
+
+	tests := []struct {
+		name         string
+		events       []Event[any]
+		wantStatus   SagaStatus
+		wantSteps    []string
+		wantReleased []string
+	}{
+		{
+			name: "payment completed",
+			events: []Event[any]{
+				sagaEvent(TypeUserEnrolled, "flow-1", enrolled),
+				sagaEvent(TypePaymentCompleted, "flow-1", PaymentCompletedEvent{}),
+			},
+			wantStatus: SagaCompleted,
+			wantSteps:  []string{"reserve", "paid"},
+		},
+		{
+			name: "payment failed",
+			events: []Event[any]{
+				sagaEvent(TypeUserEnrolled, "flow-1", enrolled),
+				sagaEvent(TypePaymentFailed, "flow-1", PaymentFailedEvent{}),
+				sagaEvent(TypePaymentCompleted, "flow-1", PaymentCompletedEvent{}),
+			},
+			wantStatus:   SagaCompensated,
+			wantSteps:    []string{"reserve", "payment-failed"},
+			wantReleased: []string{"c1"},
+		},
+		{
+			name: "redelivered start",
+			events: []Event[any]{
+				sagaEvent(TypeUserEnrolled, "flow-1", enrolled),
+				sagaEvent(TypeUserEnrolled, "flow-1", enrolled),
+			},
+			wantStatus: SagaRunning,
+			wantSteps:  []string{"reserve"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemorySagaStore()
+			var released []string
+			saga := enrollmentSaga(t, store, &released, time.Hour)
+
+			// Unrelated flows and events without a saga are ignored
+			if err := saga.Handle(context.Background(), sagaEvent(TypePaymentCompleted, "flow-2", PaymentCompletedEvent{})); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			for _, e := range tt.events {
+				if err := saga.Handle(context.Background(), e); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+
+			inst, err := store.Load(context.Background(), "enrollment", "flow-1")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if inst.Status != tt.wantStatus || !slices.Equal(inst.Steps, tt.wantSteps) {
+				t.Errorf("Want %s after %v, got %s after %v", tt.wantStatus, tt.wantSteps, inst.Status, inst.Steps)
+			}
+			if !slices.Equal(released, tt.wantReleased) {
+				t.Errorf("Want released %v, got %v", tt.wantReleased, released)
+			}
+			if _, err := store.Load(context.Background(), "enrollment", "flow-2"); !errors.Is(err, ErrSagaNotFound) {
+				t.Errorf("Want ErrSagaNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSaga_Timeout(t *testing.T) {
+	store := NewMemorySagaStore()
+	var released []string
+	saga := enrollmentSaga(t, store, &released, time.Millisecond)
+
+	err := saga.Handle(context.Background(), sagaEvent(TypeUserEnrolled, "flow-1", UserEnrolledEvent{CourseID: "c1"}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	n, err := saga.CheckTimeouts(context.Background())
+	if err != nil || n != 1 {
+		t.Fatalf("Want 1 timed out saga, got %d, %v", n, err)
+	}
+	inst, _ := store.Load(context.Background(), "enrollment", "flow-1")
+	if inst.Status != SagaCompensated || inst.Error != "timed out after step reserve" {
+		t.Errorf("Want compensated after a timeout, got %s: %q", inst.Status, inst.Error)
+	}
+	if !slices.Equal(released, []string{"c1"}) {
+		t.Errorf("Want spot in c1 released, got %v", released)
+	}
+
+	// A late payment does not revive the saga
+	if err := saga.Handle(context.Background(), sagaEvent(TypePaymentCompleted, "flow-1", PaymentCompletedEvent{})); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if inst, _ := store.Load(context.Background(), "enrollment", "flow-1"); inst.Status != SagaCompensated {
+		t.Errorf("Want saga to stay compensated, got %s", inst.Status)
+	}
+}
+
+func TestSaga_CompensationRetry(t *testing.T) {
+	store := NewMemorySagaStore()
+	failures := 1
+	saga, err := NewSaga("retry", store, []SagaStep[struct{}]{
+		{
+			Name:   "start",
+			On:     TypeUserEnrolled,
+			Handle: func(ctx context.Context, state *struct{}, event Event[any]) error { return nil },
+			Compensate: func(ctx context.Context, state *struct{}) error {
+				if failures > 0 {
+					failures--
+					return errors.New("course service unavailable")
+				}
+				return nil
+			},
+		},
+		{
+			Name:   "failed",
+			On:     TypePaymentFailed,
+			Handle: func(ctx context.Context, state *struct{}, event Event[any]) error { return nil },
+			Aborts: true,
+		},
+	}, WithSagaRetryDelay(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range []Event[any]{sagaEvent(TypeUserEnrolled, "flow-1", nil), sagaEvent(TypePaymentFailed, "flow-1", nil)} {
+		if err := saga.Handle(context.Background(), e); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	inst, _ := store.Load(context.Background(), "retry", "flow-1")
+	if inst.Status != SagaCompensating || !slices.Equal(inst.Compensated, []string{"failed"}) {
+		t.Fatalf("Want compensation to stop at the failing step, got %s with %v compensated", inst.Status, inst.Compensated)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if _, err := saga.CheckTimeouts(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	inst, _ = store.Load(context.Background(), "retry", "flow-1")
+	if inst.Status != SagaCompensated || !slices.Equal(inst.Compensated, []string{"failed", "start"}) {
+		t.Errorf("Want compensation completed, got %s with %v compensated", inst.Status, inst.Compensated)
+	}
+}
+
+func TestPostgresSagaStore_SaveConflict(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec("UPDATE sagas").
+		WithArgs("enrollment", "flow-1", SagaRunning, []byte(`["reserve"]`), []byte(`[]`), []byte(`{}`), "", sqlmock.AnyArg(), sqlmock.AnyArg(), 3).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	store := NewPostgresSagaStore(db)
+	inst := &SagaInstance{Saga: "enrollment", CorrelationID: "flow-1", Status: SagaRunning, Steps: []string{"reserve"}, Version: 3}
+	if err := store.Save(context.Background(), inst); !errors.Is(err, ErrSagaConflict) {
+		t.Errorf("Want ErrSagaConflict, got %v", err)
+	}
+	if inst.Version != 3 {
+		t.Errorf("Want version unchanged, got %d", inst.Version)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNewSaga_DuplicateTrigger(t *testing.T) {
+	handle := func(ctx context.Context, state *struct{}, event Event[any]) error { return nil }
+	_, err := NewSaga("duplicate", NewMemorySagaStore(), []SagaStep[struct{}]{
+		{Name: "start", On: TypeUserEnrolled, Handle: handle},
+		{Name: "paid", On: TypePaymentCompleted, Handle: handle},
+		{Name: "restart", On: TypeUserEnrolled, Handle: handle},
+	})
+	if err == nil || !strings.Contains(err.Error(), "start and restart") {
+		t.Errorf("Want an error naming both steps, got %v", err)
+	}
+}
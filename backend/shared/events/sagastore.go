@@ -0,0 +1,241 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrSagaNotFound is returned when a saga has no instance for a
+	// correlation ID
+	ErrSagaNotFound = errors.New("saga not found")
+
+	// ErrSagaConflict is returned when saving a saga instance that was
+	// changed since it was loaded
+	ErrSagaConflict = errors.New("saga instance was modified concurrently")
+)
+
+// SagaStore persists saga instances
+type SagaStore interface {
+	// Load returns the instance of saga for correlationID, or ErrSagaNotFound
+	Load(ctx context.Context, saga string, correlationID string) (*SagaInstance, error)
+
+	// Save inserts inst if its version is 0 and updates it otherwise. It
+	// fails with ErrSagaConflict if the stored version differs from the
+	// version inst was loaded with, and increments the version on success.
+	Save(ctx context.Context, inst *SagaInstance) error
+
+	// Due returns up to limit running or compensating instances of saga
+	// whose deadline is not after now, earliest first
+	Due(ctx context.Context, saga string, now time.Time, limit int) ([]*SagaInstance, error)
+}
+
+// PostgresSagaStore keeps saga instances in the sagas table
+type PostgresSagaStore struct {
+	db *sql.DB
+}
+
+// NewPostgresSagaStore creates a store on db. The sagas table is created by
+// Migrate.
+func NewPostgresSagaStore(db *sql.DB) *PostgresSagaStore {
+	return &PostgresSagaStore{
+		db: db,
+	}
+}
+
+const sagaColumns = `saga, correlation_id, status, steps, compensated, state, error, deadline, version, created_at, updated_at`
+
+// Load implements SagaStore
+func (s *PostgresSagaStore) Load(ctx context.Context, saga string, correlationID string) (*SagaInstance, error) {
+	query := `SELECT ` + sagaColumns + ` FROM sagas WHERE saga = $1 AND correlation_id = $2`
+	inst, err := scanSaga(s.db.QueryRowContext(ctx, query, saga, correlationID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSagaNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load saga: %w", err)
+	}
+	return inst, nil
+}
+
+// Save implements SagaStore
+func (s *PostgresSagaStore) Save(ctx context.Context, inst *SagaInstance) error {
+	steps, err := json.Marshal(nonNil(inst.Steps))
+	if err != nil {
+		return fmt.Errorf("failed to encode saga steps: %w", err)
+	}
+	compensated, err := json.Marshal(nonNil(inst.Compensated))
+	if err != nil {
+		return fmt.Errorf("failed to encode saga steps: %w", err)
+	}
+	state := inst.State
+	if len(state) == 0 {
+		state = json.RawMessage(`{}`)
+	}
+	deadline := sql.NullTime{Time: inst.Deadline, Valid: !inst.Deadline.IsZero()}
+	now := time.Now().UTC()
+
+	var res sql.Result
+	if inst.Version == 0 {
+		query := `INSERT INTO sagas (` + sagaColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, 1, $9, $9)
+			ON CONFLICT DO NOTHING`
+		res, err = s.db.ExecContext(ctx, query, inst.Saga, inst.CorrelationID, inst.Status, steps, compensated, []byte(state), inst.Error, deadline, now)
+	} else {
+		query := `UPDATE sagas SET status = $3, steps = $4, compensated = $5, state = $6, error = $7, deadline = $8,
+			version = version + 1, updated_at = $9
+			WHERE saga = $1 AND correlation_id = $2 AND version = $10`
+		res, err = s.db.ExecContext(ctx, query, inst.Saga, inst.CorrelationID, inst.Status, steps, compensated, []byte(state), inst.Error, deadline, now, inst.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save saga: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to save saga: %w", err)
+	}
+	if n == 0 {
+		return ErrSagaConflict
+	}
+
+	if inst.Version == 0 {
+		inst.CreatedAt = now
+	}
+	inst.Version++
+	inst.UpdatedAt = now
+	return nil
+}
+
+// Due implements SagaStore
+func (s *PostgresSagaStore) Due(ctx context.Context, saga string, now time.Time, limit int) ([]*SagaInstance, error) {
+	query := `SELECT ` + sagaColumns + ` FROM sagas
+		WHERE saga = $1 AND deadline <= $2 AND status IN ('running', 'compensating')
+		ORDER BY deadline
+		LIMIT $3`
+	rows, err := s.db.QueryContext(ctx, query, saga, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query due sagas: %w", err)
+	}
+	defer rows.Close()
+
+	var due []*SagaInstance
+	for rows.Next() {
+		inst, err := scanSaga(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan saga: %w", err)
+		}
+		due = append(due, inst)
+	}
+	return due, rows.Err()
+}
+
+// scanner is implemented by *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSaga(row scanner) (*SagaInstance, error) {
+	var inst SagaInstance
+	var steps, compensated, state []byte
+	var deadline sql.NullTime
+	err := row.Scan(&inst.Saga, &inst.CorrelationID, &inst.Status, &steps, &compensated, &state,
+		&inst.Error, &deadline, &inst.Version, &inst.CreatedAt, &inst.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(steps, &inst.Steps); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(compensated, &inst.Compensated); err != nil {
+		return nil, err
+	}
+	inst.State = state
+	inst.Deadline = deadline.Time
+	return &inst, nil
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// MemorySagaStore keeps saga instances in memory. It suits tests and local
+// development.
+type MemorySagaStore struct {
+	mu        sync.Mutex
+	instances map[string]SagaInstance
+}
+
+// NewMemorySagaStore creates an empty store
+func NewMemorySagaStore() *MemorySagaStore {
+	return &MemorySagaStore{
+		instances: make(map[string]SagaInstance),
+	}
+}
+
+// Load implements SagaStore
+func (s *MemorySagaStore) Load(ctx context.Context, saga string, correlationID string) (*SagaInstance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inst, ok := s.instances[saga+"/"+correlationID]
+	if !ok {
+		return nil, ErrSagaNotFound
+	}
+	return cloneSaga(inst), nil
+}
+
+// Save implements SagaStore
+func (s *MemorySagaStore) Save(ctx context.Context, inst *SagaInstance) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := inst.Saga + "/" + inst.CorrelationID
+	stored, ok := s.instances[key]
+	if ok != (inst.Version > 0) || stored.Version != inst.Version {
+		return ErrSagaConflict
+	}
+
+	now := time.Now().UTC()
+	if !ok {
+		inst.CreatedAt = now
+	}
+	inst.Version++
+	inst.UpdatedAt = now
+	s.instances[key] = *cloneSaga(*inst)
+	return nil
+}
+
+// Due implements SagaStore
+func (s *MemorySagaStore) Due(ctx context.Context, saga string, now time.Time, limit int) ([]*SagaInstance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []*SagaInstance
+	for _, inst := range s.instances {
+		if inst.Saga == saga && !inst.Deadline.IsZero() && !inst.Deadline.After(now) &&
+			(inst.Status == SagaRunning || inst.Status == SagaCompensating) {
+			due = append(due, cloneSaga(inst))
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].Deadline.Before(due[j].Deadline) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+func cloneSaga(inst SagaInstance) *SagaInstance {
+	inst.Steps = slices.Clone(inst.Steps)
+	inst.Compensated = slices.Clone(inst.Compensated)
+	inst.State = slices.Clone(inst.State)
+	return &inst
+}
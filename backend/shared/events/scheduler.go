@@ -0,0 +1,275 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// schedulerLockID is the Postgres advisory lock that serialises scheduler
+// polls, so that a due event is published by one poller only
+const schedulerLockID int64 = 0x7363686564
+
+var (
+	// ErrNoScheduler is returned by PublishAt and PublishAfter when the
+	// publisher was created without WithScheduler
+	ErrNoScheduler = errors.New("publisher has no scheduler")
+
+	// ErrScheduledEventNotFound is returned when cancelling an event that is
+	// not scheduled, or that was already published or cancelled
+	ErrScheduledEventNotFound = errors.New("scheduled event not found")
+)
+
+// Scheduler stores events in the scheduled_events table and publishes them
+// through its publisher once they are due. Events are published at least
+// once, no earlier than their publish time.
+type Scheduler struct {
+	db          *sql.DB
+	publisher   *Publisher
+	batchSize   int
+	interval    time.Duration
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+}
+
+// SchedulerOption configures optional Scheduler behaviour
+type SchedulerOption func(*Scheduler)
+
+// WithSchedulerBatchSize sets the number of due events read per poll
+func WithSchedulerBatchSize(n int) SchedulerOption {
+	return func(s *Scheduler) {
+		s.batchSize = n
+	}
+}
+
+// WithSchedulerInterval sets how often the scheduler polls for due events,
+// which bounds how late an event is published
+func WithSchedulerInterval(d time.Duration) SchedulerOption {
+	return func(s *Scheduler) {
+		s.interval = d
+	}
+}
+
+// WithSchedulerBackoff sets the exponential backoff between publish attempts
+// of a due event that failed to publish
+func WithSchedulerBackoff(base, max time.Duration) SchedulerOption {
+	return func(s *Scheduler) {
+		s.baseBackoff = base
+		s.maxBackoff = max
+	}
+}
+
+// WithScheduler enables PublishAt and PublishAfter, storing scheduled events
+// in db. Run the poller with Publisher.Scheduler().Run. The scheduled_events
+// table is created by Migrate.
+func WithScheduler(db *sql.DB, opts ...SchedulerOption) PublisherOption {
+	return func(p *Publisher) {
+		s := &Scheduler{
+			db:          db,
+			publisher:   p,
+			batchSize:   100,
+			interval:    time.Second,
+			baseBackoff: time.Second,
+			maxBackoff:  5 * time.Minute,
+		}
+		for _, opt := range opts {
+			opt(s)
+		}
+		p.scheduler = s
+	}
+}
+
+// ScheduledEvent is an event waiting in the scheduler
+type ScheduledEvent struct {
+	EventID   string
+	Type      string
+	PublishAt time.Time
+	Attempts  int
+	LastError string
+	CreatedAt time.Time
+	Payload   json.RawMessage // JSON encoded event
+}
+
+// Schedule stores event to be published at t and returns its ID. The event
+// is enriched from ctx and validated now; its OccurredAt defaults to t.
+// Scheduled events are stored and published as JSON whatever codec the
+// publisher uses.
+func (s *Scheduler) Schedule(ctx context.Context, event Event[any], t time.Time) (string, error) {
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = t.UTC()
+	}
+	s.publisher.enrich(ctx, &event)
+
+	payload, err := s.publisher.marshal(event)
+	if err != nil {
+		return "", err
+	}
+
+	query := `INSERT INTO scheduled_events (event_id, event_type, payload, publish_at, next_attempt_at) VALUES ($1, $2, $3, $4, $4)`
+	if _, err := s.db.ExecContext(ctx, query, event.ID, event.Type, payload, t.UTC()); err != nil {
+		return "", fmt.Errorf("failed to schedule event: %w", err)
+	}
+	return event.ID, nil
+}
+
+// Cancel cancels the scheduled event with the given ID
+func (s *Scheduler) Cancel(ctx context.Context, eventID string) error {
+	query := `UPDATE scheduled_events SET cancelled_at = $1
+		WHERE event_id = $2 AND published_at IS NULL AND cancelled_at IS NULL`
+	res, err := s.db.ExecContext(ctx, query, time.Now().UTC(), eventID)
+	if err != nil {
+		return fmt.Errorf("failed to cancel scheduled event: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to cancel scheduled event: %w", err)
+	}
+	if n == 0 {
+		return ErrScheduledEventNotFound
+	}
+	return nil
+}
+
+// List returns up to limit events still waiting to be published, earliest
+// first. An empty eventType lists events of all types.
+func (s *Scheduler) List(ctx context.Context, eventType string, limit int) ([]ScheduledEvent, error) {
+	query := `SELECT event_id, event_type, publish_at, attempts, COALESCE(last_error, ''), created_at, payload
+		FROM scheduled_events
+		WHERE published_at IS NULL AND cancelled_at IS NULL AND ($1 = '' OR event_type = $1)
+		ORDER BY publish_at, id`
+	args := []any{eventType}
+	if limit > 0 {
+		query += ` LIMIT $2`
+		args = append(args, limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scheduled events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []ScheduledEvent
+	for rows.Next() {
+		var e ScheduledEvent
+		if err := rows.Scan(&e.EventID, &e.Type, &e.PublishAt, &e.Attempts, &e.LastError, &e.CreatedAt, &e.Payload); err != nil {
+			return nil, fmt.Errorf("failed to scan scheduled event: %w", err)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+type scheduledEntry struct {
+	id        int64
+	eventID   string
+	eventType string
+	payload   []byte
+	attempts  int
+}
+
+// Run publishes due events until ctx is cancelled
+func (s *Scheduler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := s.Poll(ctx)
+		if err != nil {
+			log.Printf("Failed to poll scheduled events: %v", err)
+		}
+		if n == s.batchSize {
+			// More events are likely due
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll publishes one batch of due events and returns how many were
+// published. Events that fail to publish are retried with backoff.
+func (s *Scheduler) Poll(ctx context.Context) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRowContext(ctx, "SELECT pg_try_advisory_xact_lock($1)", schedulerLockID).Scan(&locked); err != nil {
+		return 0, fmt.Errorf("failed to acquire scheduler lock: %w", err)
+	}
+	if !locked {
+		// Another poller is running
+		return 0, nil
+	}
+
+	now := time.Now().UTC()
+	query := `SELECT id, event_id, event_type, payload, attempts
+		FROM scheduled_events
+		WHERE published_at IS NULL AND cancelled_at IS NULL AND next_attempt_at <= $1
+		ORDER BY next_attempt_at, id LIMIT $2
+		FOR UPDATE SKIP LOCKED`
+	rows, err := tx.QueryContext(ctx, query, now, s.batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query scheduled events: %w", err)
+	}
+	var entries []scheduledEntry
+	for rows.Next() {
+		var e scheduledEntry
+		if err := rows.Scan(&e.id, &e.eventID, &e.eventType, &e.payload, &e.attempts); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan scheduled event: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to query scheduled events: %w", err)
+	}
+
+	published := 0
+	for _, e := range entries {
+		// Claim the event before publishing it, so that an event cancelled
+		// since it was read is not published
+		query := `UPDATE scheduled_events SET published_at = $1
+			WHERE id = $2 AND published_at IS NULL AND cancelled_at IS NULL`
+		res, err := tx.ExecContext(ctx, query, now, e.id)
+		if err != nil {
+			return published, fmt.Errorf("failed to mark scheduled event published: %w", err)
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return published, fmt.Errorf("failed to mark scheduled event published: %w", err)
+		} else if n == 0 {
+			continue
+		}
+
+		event := metadataOf(e.payload)
+		event.ID, event.Type = e.eventID, e.eventType
+		if _, err := s.publisher.send(ctx, event, ContentTypeJSON, e.payload); err != nil {
+			log.Printf("Failed to publish scheduled event %s: %v", e.eventID, err)
+
+			next := now.Add(backoff(e.attempts+1, s.baseBackoff, s.maxBackoff))
+			query := `UPDATE scheduled_events SET attempts = attempts + 1, published_at = NULL, last_error = $1, next_attempt_at = $2 WHERE id = $3`
+			if _, err := tx.ExecContext(ctx, query, err.Error(), next, e.id); err != nil {
+				return published, fmt.Errorf("failed to record scheduled event failure: %w", err)
+			}
+			continue
+		}
+		published++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return published, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return published, nil
+}
@@ -0,0 +1,155 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestPublisher_PublishAt(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	at := time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)
+	mock.ExpectExec("INSERT INTO scheduled_events").
+		WithArgs("e1", "progress.assignment.due", sqlmock.AnyArg(), at).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	publisher := NewPublisher(NewJetStreamBroker(&recordingJetStream{}), "test-service", WithScheduler(db))
+	id, err := publisher.PublishAt(context.Background(), Event[any]{ID: "e1", Type: "progress.assignment.due"}, at)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if id != "e1" {
+		t.Errorf("Want ID e1, got %q", id)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	_, err = NewPublisher(NewJetStreamBroker(&recordingJetStream{}), "test-service").PublishAfter(context.Background(), Event[any]{}, time.Hour)
+	if !errors.Is(err, ErrNoScheduler) {
+		t.Errorf("Want ErrNoScheduler, got %v", err)
+	}
+}
+
+func TestScheduler_Poll(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	payload, _ := json.Marshal(Event[any]{ID: "e2", Type: "ok.event", TraceID: "4bf92f3577b34da6a3ce929d0e0e4736"})
+	rows := sqlmock.NewRows([]string{"id", "event_id", "event_type", "payload", "attempts"}).
+		AddRow(1, "e1", "fail.event", []byte(`{}`), 2).
+		AddRow(2, "e2", "ok.event", payload, 0)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT pg_try_advisory_xact_lock").WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+	mock.ExpectQuery("SELECT (.+) FROM scheduled_events (.+) FOR UPDATE SKIP LOCKED").WillReturnRows(rows)
+	mock.ExpectExec("UPDATE scheduled_events SET published_at (.+) cancelled_at IS NULL").WithArgs(sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE scheduled_events SET attempts (.+) published_at = NULL").WithArgs("publish failed", sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE scheduled_events SET published_at (.+) cancelled_at IS NULL").WithArgs(sqlmock.AnyArg(), 2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	js := &recordingJetStream{fail: map[string]bool{"fail.event": true}}
+	publisher := NewPublisher(NewJetStreamBroker(js), "test-service", WithScheduler(db))
+
+	n, err := publisher.Scheduler().Poll(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if n != 1 || len(js.subjects) != 1 || js.subjects[0] != "ok.event" {
+		t.Errorf("Want ok.event published, got %d published to %v", n, js.subjects)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestScheduler_PollSkipsCancelled(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"id", "event_id", "event_type", "payload", "attempts"}).
+		AddRow(1, "e1", "ok.event", []byte(`{}`), 0)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT pg_try_advisory_xact_lock").WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+	mock.ExpectQuery("SELECT (.+) FROM scheduled_events").WillReturnRows(rows)
+	// The event is cancelled after it was read, so claiming it affects no row
+	mock.ExpectExec("UPDATE scheduled_events SET published_at (.+) cancelled_at IS NULL").WithArgs(sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	js := &recordingJetStream{}
+	publisher := NewPublisher(NewJetStreamBroker(js), "test-service", WithScheduler(db))
+
+	n, err := publisher.Scheduler().Poll(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if n != 0 || len(js.subjects) != 0 {
+		t.Errorf("Want the cancelled event not published, got %d published to %v", n, js.subjects)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestScheduler_Cancel(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec("UPDATE scheduled_events SET cancelled_at").WithArgs(sqlmock.AnyArg(), "e1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE scheduled_events SET cancelled_at").WithArgs(sqlmock.AnyArg(), "e1").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	scheduler := NewPublisher(NewJetStreamBroker(&recordingJetStream{}), "test-service", WithScheduler(db)).Scheduler()
+	if err := scheduler.Cancel(context.Background(), "e1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := scheduler.Cancel(context.Background(), "e1"); !errors.Is(err, ErrScheduledEventNotFound) {
+		t.Errorf("Want ErrScheduledEventNotFound, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestScheduler_List(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	at := time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT (.+) FROM scheduled_events").WithArgs("billing.trial.expired", 10).
+		WillReturnRows(sqlmock.NewRows([]string{"event_id", "event_type", "publish_at", "attempts", "last_error", "created_at", "payload"}).
+			AddRow("e1", "billing.trial.expired", at, 0, "", at, []byte(`{}`)))
+
+	scheduler := NewPublisher(NewJetStreamBroker(&recordingJetStream{}), "test-service", WithScheduler(db)).Scheduler()
+	events, err := scheduler.List(context.Background(), "billing.trial.expired", 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(events) != 1 || events[0].EventID != "e1" || !events[0].PublishAt.Equal(at) {
+		t.Errorf("Want e1 at %v, got %+v", at, events)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,264 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrInvalidEvent is returned when an event does not match the JSON Schema of
+// its type
+var ErrInvalidEvent = errors.New("event does not match its schema")
+
+// SchemaDraft is the JSON Schema dialect of generated schemas
+const SchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is the subset of JSON Schema needed to describe event envelopes and
+// payload structs
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Type                 SchemaType         `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Const                any                `json:"const,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// SchemaType lists the JSON types a value may have. A single type is encoded
+// as a string, several as an array.
+type SchemaType []string
+
+// MarshalJSON implements json.Marshaler
+func (t SchemaType) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (t *SchemaType) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = SchemaType{single}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(t))
+}
+
+// SchemaOf generates the schema of the JSON encoding of t. Struct fields are
+// required unless they are tagged omitempty; nil slices, maps and pointers
+// may be null.
+func SchemaOf(t reflect.Type) *Schema {
+	nullable := false
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+		nullable = true
+	}
+
+	var s *Schema
+	switch {
+	case t == timeType:
+		s = &Schema{Type: SchemaType{"string"}, Format: "date-time"}
+	case t.Kind() == reflect.Struct:
+		s = &Schema{Type: SchemaType{"object"}, Properties: make(map[string]*Schema)}
+		addProperties(s, t)
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		// []byte is encoded as a base64 string
+		s = &Schema{Type: SchemaType{"string"}}
+		nullable = true
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		s = &Schema{Type: SchemaType{"array"}, Items: SchemaOf(t.Elem())}
+		nullable = nullable || t.Kind() == reflect.Slice
+	case t.Kind() == reflect.Map:
+		s = &Schema{Type: SchemaType{"object"}, AdditionalProperties: SchemaOf(t.Elem())}
+		nullable = true
+	case t.Kind() == reflect.String:
+		s = &Schema{Type: SchemaType{"string"}}
+	case t.Kind() == reflect.Bool:
+		s = &Schema{Type: SchemaType{"boolean"}}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		s = &Schema{Type: SchemaType{"integer"}}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		s = &Schema{Type: SchemaType{"number"}}
+	default:
+		// Interfaces accept any value
+		return &Schema{}
+	}
+
+	if nullable {
+		s.Type = append(s.Type, "null")
+	}
+	return s
+}
+
+// addProperties adds the JSON fields of struct type t to s
+func addProperties(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" && f.Anonymous && f.Type.Kind() == reflect.Struct {
+			addProperties(s, f.Type)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		s.Properties[name] = SchemaOf(f.Type)
+		if !slices.Contains(strings.Split(opts, ","), "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+	sort.Strings(s.Required)
+}
+
+// EnvelopeSchema returns the schema of an Event envelope of eventType whose
+// data has the given schema. An empty eventType matches any event type.
+func EnvelopeSchema(eventType string, data *Schema) *Schema {
+	s := SchemaOf(reflect.TypeFor[Event[any]]())
+	s.Schema = SchemaDraft
+	s.Title = "Event"
+	// Older publishers left the tracing fields and schema version empty
+	s.Required = []string{"id", "occurred_at", "type"}
+
+	if eventType != "" {
+		s.Title = eventType
+		s.Properties["type"] = &Schema{Type: SchemaType{"string"}, Const: eventType}
+	}
+	if data != nil {
+		s.Properties["data"] = data
+		s.Required = append(s.Required, "data")
+		sort.Strings(s.Required)
+	}
+	return s
+}
+
+// Schema returns the JSON Schema of events of eventType. Unregistered event
+// types only have their envelope described.
+func (r *Registry) Schema(eventType string) *Schema {
+	t, ok := r.Lookup(eventType)
+	if !ok {
+		return EnvelopeSchema(eventType, nil)
+	}
+	return EnvelopeSchema(eventType, SchemaOf(t))
+}
+
+// Validate checks the encoded event data against the schema of its type.
+// Events of an older schema version only have their envelope checked, since
+// their payload is migrated by upcasters on decode.
+func (r *Registry) Validate(data []byte) error {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+
+	var head struct {
+		Type          string `json:"type"`
+		SchemaVersion int    `json:"schema_version"`
+	}
+	_ = json.Unmarshal(data, &head)
+
+	schema := r.Schema(head.Type)
+	if max(head.SchemaVersion, 1) < r.Version(head.Type) {
+		schema.Properties["data"] = &Schema{}
+	}
+
+	if problems := schema.Validate(v); len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidEvent, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Validate checks a decoded JSON value against s and returns the problems
+// found. Properties not described by s are allowed, so consumers keep
+// accepting events with fields added after their schema was generated.
+func (s *Schema) Validate(v any) []string {
+	var problems []string
+	s.validate("$", v, &problems)
+	sort.Strings(problems)
+	return problems
+}
+
+func (s *Schema) validate(path string, v any, problems *[]string) {
+	if len(s.Type) > 0 && !slices.ContainsFunc(s.Type, func(t string) bool { return hasJSONType(v, t) }) {
+		*problems = append(*problems, fmt.Sprintf("%s: want %s, got %s", path, strings.Join(s.Type, " or "), jsonType(v)))
+		return
+	}
+	if s.Const != nil && v != s.Const {
+		*problems = append(*problems, fmt.Sprintf("%s: want %v, got %v", path, s.Const, v))
+	}
+
+	switch v := v.(type) {
+	case string:
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, v); err != nil {
+				*problems = append(*problems, fmt.Sprintf("%s: want date-time, got %q", path, v))
+			}
+		}
+	case []any:
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, problems)
+			}
+		}
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				*problems = append(*problems, fmt.Sprintf("%s: missing %s", path, name))
+			}
+		}
+		for name, value := range v {
+			if prop, ok := s.Properties[name]; ok {
+				prop.validate(path+"."+name, value, problems)
+			} else if s.AdditionalProperties != nil {
+				s.AdditionalProperties.validate(path+"."+name, value, problems)
+			}
+		}
+	}
+}
+
+func hasJSONType(v any, t string) bool {
+	switch t {
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	}
+	return jsonType(v) == t
+}
+
+func jsonType(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,151 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/nats-io/nats.go"
+)
+
+func TestSchemaOf(t *testing.T) {
+	s := SchemaOf(reflect.TypeFor[CourseCreatedEvent]())
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"type":"object","properties":{"created_at":{"type":"string","format":"date-time"},"id":{"type":"string"},"instructor_ids":{"type":["array","null"],"items":{"type":"string"}},"title":{"type":"string"}},"required":["created_at","id","instructor_ids","title"]}`
+	if string(b) != want {
+		t.Errorf("Want schema\n%s\ngot\n%s", want, b)
+	}
+}
+
+func TestRegistry_Validate(t *testing.T) {
+	registry := NewRegistry()
+	Register[QuizCompletedEvent](registry, TypeQuizCompleted)
+	RegisterUpcaster(registry, TypeQuizCompleted, 1, func(data json.RawMessage) (json.RawMessage, error) { return data, nil })
+
+	valid := Event[any]{
+		ID:            "e1",
+		Type:          TypeQuizCompleted,
+		SchemaVersion: 2,
+		OccurredAt:    time.Now().UTC(),
+		Data:          QuizCompletedEvent{UserID: "u1", QuizID: "q1", Score: 8, Passed: true, CompletedAt: time.Now().UTC()},
+	}
+	validJSON, _ := json.Marshal(valid)
+
+	tests := []struct {
+		name    string
+		payload string
+		wantErr string
+	}{
+		{name: "valid", payload: string(validJSON)},
+		{name: "unregistered type", payload: `{"id":"e1","type":"other.event","occurred_at":"2025-01-01T00:00:00Z","data":{"x":1}}`},
+		{name: "missing envelope field", payload: `{"type":"other.event","occurred_at":"2025-01-01T00:00:00Z"}`, wantErr: "$: missing id"},
+		{name: "bad timestamp", payload: `{"id":"e1","type":"other.event","occurred_at":"yesterday"}`, wantErr: "$.occurred_at: want date-time"},
+		{name: "missing payload field", payload: strings.Replace(string(validJSON), `"quiz_id":"q1",`, "", 1), wantErr: "$.data: missing quiz_id"},
+		{name: "wrong payload type", payload: strings.Replace(string(validJSON), `"score":8`, `"score":"8"`, 1), wantErr: "$.data.score: want number, got string"},
+		{name: "older version", payload: `{"id":"e1","type":"progress.quiz.completed","schema_version":1,"occurred_at":"2025-01-01T00:00:00Z","data":{"points":8}}`},
+		{name: "not json", payload: `{`, wantErr: "unexpected end"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := registry.Validate([]byte(tt.payload))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidEvent) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Want ErrInvalidEvent containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestPublisher_Validation(t *testing.T) {
+	js := &mockJetStream{
+		published: make(chan *nats.Msg, 1),
+	}
+	publisher := NewPublisher(NewJetStreamBroker(js), "test-service", WithPublishValidation())
+
+	err := publisher.Publish(context.Background(), Event[any]{Type: TypePaymentCompleted, Data: map[string]any{"id": "p1"}})
+	if !errors.Is(err, ErrInvalidEvent) {
+		t.Fatalf("Want ErrInvalidEvent, got %v", err)
+	}
+	if len(js.published) != 0 {
+		t.Error("Expected invalid event not to be published")
+	}
+
+	err = publisher.Publish(context.Background(), Event[any]{Type: TypePaymentCompleted, Data: PaymentCompletedEvent{ID: "p1"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestPublisher_ValidationOfStoredEvents(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	publisher := NewPublisher(NewJetStreamBroker(&recordingJetStream{}), "test-service",
+		WithPublishValidation(), WithScheduler(db))
+	invalid := Event[any]{Type: TypePaymentCompleted, Data: map[string]any{"id": "p1"}}
+
+	// Invalid events are neither added to the outbox nor scheduled
+	err = NewOutbox(db, publisher).Add(context.Background(), db, "p1", invalid)
+	if !errors.Is(err, ErrInvalidEvent) {
+		t.Errorf("Want ErrInvalidEvent from the outbox, got %v", err)
+	}
+	_, err = publisher.PublishAfter(context.Background(), invalid, time.Hour)
+	if !errors.Is(err, ErrInvalidEvent) {
+		t.Errorf("Want ErrInvalidEvent from the scheduler, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConsumer_Validation(t *testing.T) {
+	mockJS := &mockJetStream{
+		messages:  make(chan *nats.Msg, 1),
+		published: make(chan *nats.Msg, 1),
+	}
+
+	consumer := NewConsumer(NewJetStreamBroker(mockJS), "billing.payment.completed", "test-durable",
+		WithIdempotencyStore(NewMemoryIdempotencyStore(10)), WithValidation())
+	err := consumer.Start(context.Background(), func(ctx context.Context, event Event[any]) error {
+		t.Error("Expected invalid event not to reach the handler")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer consumer.Stop()
+
+	payload := `{"id":"e1","type":"billing.payment.completed","occurred_at":"2025-01-01T00:00:00Z","data":{"id":"p1","amount":"12.50"}}`
+	mockJS.messages <- &nats.Msg{Subject: "billing.payment.completed", Data: []byte(payload)}
+
+	select {
+	case msg := <-mockJS.published:
+		dl, err := decodeDeadLetter(1, msg.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(dl.Error, "$.data.amount: want integer") {
+			t.Errorf("Want schema violation in dead letter, got %q", dl.Error)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected invalid event to be dead-lettered")
+	}
+}
@@ -0,0 +1,196 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// ErrStorageMismatch is returned by Topology.Reconcile when a stream exists
+// with a different storage type than declared. JetStream cannot change the
+// storage of a stream, so it has to be migrated by hand.
+var ErrStorageMismatch = errors.New("stream storage differs from topology")
+
+// StreamSpec declares a JetStream stream
+type StreamSpec struct {
+	Name       string
+	Subjects   []string
+	Retention  nats.RetentionPolicy
+	Storage    nats.StorageType
+	Replicas   int
+	MaxAge     time.Duration
+	Duplicates time.Duration // Window in which messages with the same Nats-Msg-Id are dropped
+}
+
+// ConsumerSpec declares a durable JetStream consumer. Consumers reading a
+// provisioned durable should be built with WithBindStream, and their AckWait
+// should match the spec.
+type ConsumerSpec struct {
+	Stream        string
+	Durable       string
+	FilterSubject string
+	AckWait       time.Duration
+	MaxAckPending int
+	Pull          bool // Pull consumers are used with WithPullBatch
+}
+
+// Topology is the set of streams and durable consumers a service relies on
+type Topology struct {
+	Streams   []StreamSpec
+	Consumers []ConsumerSpec
+}
+
+// DefaultTopology returns one stream per domain plus the dead-letter stream.
+// Services append their durable consumers before reconciling.
+func DefaultTopology() Topology {
+	domain := func(name string, subject string, maxAge time.Duration) StreamSpec {
+		return StreamSpec{
+			Name:       name,
+			Subjects:   []string{subject},
+			Retention:  nats.LimitsPolicy,
+			Storage:    nats.FileStorage,
+			Replicas:   1,
+			MaxAge:     maxAge,
+			Duplicates: 2 * time.Minute,
+		}
+	}
+
+	return Topology{
+		Streams: []StreamSpec{
+			domain("USER", "user.>", 30*24*time.Hour),
+			domain("COURSE", "course.>", 30*24*time.Hour),
+			domain("PROGRESS", "progress.>", 14*24*time.Hour),
+			domain("BILLING", "billing.>", 90*24*time.Hour),
+			domain("NOTIFICATION", "notification.>", 7*24*time.Hour),
+			domain(DeadLetterStream, DeadLetterPrefix+">", 30*24*time.Hour),
+		},
+	}
+}
+
+// AddConsumer appends a durable consumer to the topology
+func (t *Topology) AddConsumer(spec ConsumerSpec) {
+	t.Consumers = append(t.Consumers, spec)
+}
+
+// Reconcile creates missing streams and consumers and updates those whose
+// configuration differs from the topology. It is safe to call at every
+// service startup. Streams whose storage differs fail with
+// ErrStorageMismatch.
+func (t Topology) Reconcile(ctx context.Context, jsm nats.JetStreamManager) error {
+	for _, spec := range t.Streams {
+		if err := reconcileStream(ctx, jsm, spec); err != nil {
+			return err
+		}
+	}
+	for _, spec := range t.Consumers {
+		if err := reconcileConsumer(ctx, jsm, spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func reconcileStream(ctx context.Context, jsm nats.JetStreamManager, spec StreamSpec) error {
+	info, err := jsm.StreamInfo(spec.Name, nats.Context(ctx))
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		cfg := &nats.StreamConfig{Name: spec.Name}
+		spec.apply(cfg)
+		if _, err := jsm.AddStream(cfg, nats.Context(ctx)); err != nil {
+			return fmt.Errorf("failed to add stream %s: %w", spec.Name, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get stream %s: %w", spec.Name, err)
+	}
+
+	cfg := info.Config
+	if spec.matches(cfg) {
+		return nil
+	}
+	if cfg.Storage != spec.Storage {
+		return fmt.Errorf("%w: stream %s uses %s storage, want %s", ErrStorageMismatch, spec.Name, cfg.Storage, spec.Storage)
+	}
+	spec.apply(&cfg)
+	if _, err := jsm.UpdateStream(&cfg, nats.Context(ctx)); err != nil {
+		return fmt.Errorf("failed to update stream %s: %w", spec.Name, err)
+	}
+	return nil
+}
+
+func (s StreamSpec) apply(cfg *nats.StreamConfig) {
+	cfg.Subjects = s.Subjects
+	cfg.Retention = s.Retention
+	cfg.Storage = s.Storage
+	cfg.Replicas = s.Replicas
+	cfg.MaxAge = s.MaxAge
+	cfg.Duplicates = s.Duplicates
+}
+
+func (s StreamSpec) matches(cfg nats.StreamConfig) bool {
+	return slices.Equal(cfg.Subjects, s.Subjects) &&
+		cfg.Retention == s.Retention &&
+		cfg.Storage == s.Storage &&
+		cfg.Replicas == s.Replicas &&
+		cfg.MaxAge == s.MaxAge &&
+		(s.Duplicates == 0 || cfg.Duplicates == s.Duplicates)
+}
+
+func reconcileConsumer(ctx context.Context, jsm nats.JetStreamManager, spec ConsumerSpec) error {
+	info, err := jsm.ConsumerInfo(spec.Stream, spec.Durable, nats.Context(ctx))
+	if errors.Is(err, nats.ErrConsumerNotFound) {
+		cfg := &nats.ConsumerConfig{
+			Durable:       spec.Durable,
+			AckPolicy:     nats.AckExplicitPolicy,
+			DeliverPolicy: nats.DeliverAllPolicy,
+		}
+		spec.apply(cfg)
+		if _, err := jsm.AddConsumer(spec.Stream, cfg, nats.Context(ctx)); err != nil {
+			return fmt.Errorf("failed to add consumer %s: %w", spec.Durable, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get consumer %s: %w", spec.Durable, err)
+	}
+
+	cfg := info.Config
+	if spec.matches(cfg) {
+		return nil
+	}
+	spec.apply(&cfg)
+	if _, err := jsm.UpdateConsumer(spec.Stream, &cfg, nats.Context(ctx)); err != nil {
+		return fmt.Errorf("failed to update consumer %s: %w", spec.Durable, err)
+	}
+	return nil
+}
+
+// deliverSubject returns the subject a push consumer delivers to
+func (s ConsumerSpec) deliverSubject() string {
+	if s.Pull {
+		return ""
+	}
+	return "_deliver." + s.Durable
+}
+
+func (s ConsumerSpec) apply(cfg *nats.ConsumerConfig) {
+	cfg.FilterSubject = s.FilterSubject
+	cfg.DeliverSubject = s.deliverSubject()
+	if s.AckWait != 0 {
+		cfg.AckWait = s.AckWait
+	}
+	if s.MaxAckPending != 0 {
+		cfg.MaxAckPending = s.MaxAckPending
+	}
+}
+
+func (s ConsumerSpec) matches(cfg nats.ConsumerConfig) bool {
+	return cfg.FilterSubject == s.FilterSubject &&
+		(s.AckWait == 0 || cfg.AckWait == s.AckWait) &&
+		(s.MaxAckPending == 0 || cfg.MaxAckPending == s.MaxAckPending) &&
+		cfg.DeliverSubject == s.deliverSubject()
+}
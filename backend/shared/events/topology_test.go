@@ -0,0 +1,137 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// mockStreamManager keeps streams and consumers in memory and records which
+// of them were added or updated
+type mockStreamManager struct {
+	nats.JetStreamManager
+	streams   map[string]nats.StreamConfig
+	consumers map[string]nats.ConsumerConfig
+	added     []string
+	updated   []string
+}
+
+func newMockStreamManager() *mockStreamManager {
+	return &mockStreamManager{
+		streams:   make(map[string]nats.StreamConfig),
+		consumers: make(map[string]nats.ConsumerConfig),
+	}
+}
+
+func (m *mockStreamManager) StreamInfo(stream string, opts ...nats.JSOpt) (*nats.StreamInfo, error) {
+	cfg, ok := m.streams[stream]
+	if !ok {
+		return nil, nats.ErrStreamNotFound
+	}
+	return &nats.StreamInfo{Config: cfg}, nil
+}
+
+func (m *mockStreamManager) AddStream(cfg *nats.StreamConfig, opts ...nats.JSOpt) (*nats.StreamInfo, error) {
+	m.streams[cfg.Name] = *cfg
+	m.added = append(m.added, cfg.Name)
+	return &nats.StreamInfo{Config: *cfg}, nil
+}
+
+func (m *mockStreamManager) UpdateStream(cfg *nats.StreamConfig, opts ...nats.JSOpt) (*nats.StreamInfo, error) {
+	m.streams[cfg.Name] = *cfg
+	m.updated = append(m.updated, cfg.Name)
+	return &nats.StreamInfo{Config: *cfg}, nil
+}
+
+func (m *mockStreamManager) ConsumerInfo(stream string, name string, opts ...nats.JSOpt) (*nats.ConsumerInfo, error) {
+	cfg, ok := m.consumers[stream+"/"+name]
+	if !ok {
+		return nil, nats.ErrConsumerNotFound
+	}
+	return &nats.ConsumerInfo{Stream: stream, Name: name, Config: cfg}, nil
+}
+
+func (m *mockStreamManager) AddConsumer(stream string, cfg *nats.ConsumerConfig, opts ...nats.JSOpt) (*nats.ConsumerInfo, error) {
+	m.consumers[stream+"/"+cfg.Durable] = *cfg
+	m.added = append(m.added, cfg.Durable)
+	return &nats.ConsumerInfo{Stream: stream, Name: cfg.Durable, Config: *cfg}, nil
+}
+
+func (m *mockStreamManager) UpdateConsumer(stream string, cfg *nats.ConsumerConfig, opts ...nats.JSOpt) (*nats.ConsumerInfo, error) {
+	m.consumers[stream+"/"+cfg.Durable] = *cfg
+	m.updated = append(m.updated, cfg.Durable)
+	return &nats.ConsumerInfo{Stream: stream, Name: cfg.Durable, Config: *cfg}, nil
+}
+
+func TestTopology_Reconcile(t *testing.T) {
+	jsm := newMockStreamManager()
+	topology := DefaultTopology()
+	topology.AddConsumer(ConsumerSpec{
+		Stream:        "PROGRESS",
+		Durable:       "progress-projector",
+		FilterSubject: "progress.>",
+		AckWait:       30 * time.Second,
+	})
+
+	if err := topology.Reconcile(context.Background(), jsm); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(jsm.added) != len(topology.Streams)+1 || len(jsm.updated) != 0 {
+		t.Fatalf("Want everything added on first run, got added %v, updated %v", jsm.added, jsm.updated)
+	}
+	if got := jsm.consumers["PROGRESS/progress-projector"]; got.AckPolicy != nats.AckExplicitPolicy || got.DeliverSubject == "" {
+		t.Errorf("Unexpected consumer config: %+v", got)
+	}
+
+	// A second run is a no-op
+	jsm.added, jsm.updated = nil, nil
+	if err := topology.Reconcile(context.Background(), jsm); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(jsm.added) != 0 || len(jsm.updated) != 0 {
+		t.Fatalf("Want no changes, got added %v, updated %v", jsm.added, jsm.updated)
+	}
+
+	// Drifted configuration is updated
+	cfg := jsm.streams["BILLING"]
+	cfg.MaxAge = time.Hour
+	jsm.streams["BILLING"] = cfg
+	topology.Consumers[0].MaxAckPending = 100
+
+	if err := topology.Reconcile(context.Background(), jsm); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(jsm.updated) != 2 || jsm.updated[0] != "BILLING" || jsm.updated[1] != "progress-projector" {
+		t.Fatalf("Want BILLING and progress-projector updated, got %v", jsm.updated)
+	}
+	if got := jsm.streams["BILLING"].MaxAge; got != 90*24*time.Hour {
+		t.Errorf("Want BILLING max age restored, got %v", got)
+	}
+	if got := jsm.consumers["PROGRESS/progress-projector"].MaxAckPending; got != 100 {
+		t.Errorf("Want max ack pending 100, got %d", got)
+	}
+}
+
+func TestTopology_Reconcile_StorageMismatch(t *testing.T) {
+	jsm := newMockStreamManager()
+	topology := DefaultTopology()
+	if err := topology.Reconcile(context.Background(), jsm); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	cfg := jsm.streams["COURSE"]
+	cfg.Storage = nats.MemoryStorage
+	jsm.streams["COURSE"] = cfg
+	jsm.updated = nil
+
+	err := topology.Reconcile(context.Background(), jsm)
+	if !errors.Is(err, ErrStorageMismatch) {
+		t.Fatalf("Want ErrStorageMismatch, got %v", err)
+	}
+	if len(jsm.updated) != 0 {
+		t.Errorf("Want no updates, got %v", jsm.updated)
+	}
+}
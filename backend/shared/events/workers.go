@@ -0,0 +1,101 @@
+package events
+
+import (
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// KeyFunc returns the ordering key of an event. Events with the same key are
+// handled one after another, in the order they were received, as long as
+// their handlers succeed; see WithConcurrency.
+type KeyFunc func(event Event[any]) string
+
+// KeyByDataField orders events by a field of their payload, for example
+// "user_id" or "course_id". The field is matched against the json tag of
+// payload structs and against the keys of generic payloads.
+func KeyByDataField(field string) KeyFunc {
+	return func(event Event[any]) string {
+		return dataField(event.Data, field)
+	}
+}
+
+// dataField returns the string form of the named field of data, or "" if
+// data has no such field
+func dataField(data any, field string) string {
+	if m, ok := data.(map[string]any); ok {
+		if v, ok := m[field]; ok {
+			return fmt.Sprint(v)
+		}
+		return ""
+	}
+
+	v := reflect.ValueOf(data)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" {
+			name = f.Name
+		}
+		if name == field {
+			return fmt.Sprint(v.Field(i).Interface())
+		}
+	}
+	return ""
+}
+
+// workerPool runs jobs on a fixed number of workers. Jobs submitted with the
+// same key always run on the same worker and therefore in submission order.
+type workerPool struct {
+	queues []chan func()
+	wg     sync.WaitGroup
+}
+
+func newWorkerPool(workers int, queueSize int) *workerPool {
+	p := &workerPool{
+		queues: make([]chan func(), workers),
+	}
+	for i := range p.queues {
+		queue := make(chan func(), queueSize)
+		p.queues[i] = queue
+
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for job := range queue {
+				job()
+			}
+		}()
+	}
+	return p
+}
+
+// submit queues job on the worker owning key. It blocks while that worker's
+// queue is full, which applies backpressure to the subscription.
+func (p *workerPool) submit(key string, job func()) {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	p.queues[h.Sum32()%uint32(len(p.queues))] <- job
+}
+
+// close waits for all queued jobs to finish. No jobs may be submitted after
+// close is called.
+func (p *workerPool) close() {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+	p.wg.Wait()
+}
@@ -0,0 +1,94 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestKeyByDataField(t *testing.T) {
+	key := KeyByDataField("user_id")
+
+	tests := []struct {
+		name string
+		data any
+		want string
+	}{
+		{"struct", ProgressUpdatedEvent{UserID: "u1"}, "u1"},
+		{"struct pointer", &LessonCompletedEvent{UserID: "u2"}, "u2"},
+		{"generic", map[string]any{"user_id": "u3"}, "u3"},
+		{"missing field", CourseDeletedEvent{ID: "c1"}, ""},
+		{"nil", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := key(Event[any]{Data: tt.data}); got != tt.want {
+				t.Errorf("Want key %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestConsumer_Concurrency(t *testing.T) {
+	const perKey = 20
+	keys := []string{"u1", "u2", "u3"}
+
+	mockJS := &mockJetStream{
+		messages: make(chan *nats.Msg, perKey*len(keys)),
+	}
+
+	consumer := NewConsumer(NewJetStreamBroker(mockJS), "progress.updated", "test-durable",
+		WithRegistry(NewRegistry()), WithIdempotencyStore(NewMemoryIdempotencyStore(100)),
+		WithConcurrency(4, KeyByDataField("user_id")))
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	seen := make(map[string][]int)
+	wg.Add(perKey * len(keys))
+
+	err := consumer.Start(context.Background(), func(ctx context.Context, event Event[any]) error {
+		defer wg.Done()
+		data := event.Data.(map[string]any)
+		mu.Lock()
+		defer mu.Unlock()
+		seen[data["user_id"].(string)] = append(seen[data["user_id"].(string)], int(data["n"].(float64)))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer consumer.Stop()
+
+	for i := 0; i < perKey; i++ {
+		for _, key := range keys {
+			payload := fmt.Sprintf(`{"id":"%s-%d","type":"progress.updated","data":{"user_id":%q,"n":%d}}`, key, i, key, i)
+			mockJS.messages <- &nats.Msg{Subject: "progress.updated", Data: []byte(payload)}
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected all events to be handled")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, key := range keys {
+		for i, n := range seen[key] {
+			if n != i {
+				t.Fatalf("Events for %s handled out of order: %v", key, seen[key])
+			}
+		}
+	}
+}
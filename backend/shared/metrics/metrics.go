@@ -0,0 +1,43 @@
+// Package metrics provides the Prometheus registry shared by the collectors
+// of a service, and the handler that exposes it.
+package metrics
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds the collectors of the shared packages, together with the Go
+// runtime and process collectors. Services register their own collectors on
+// it as well.
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the metrics in Registry in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// WebHandler serves Handler as a web.Handler, for mounting on a web.App:
+//
+//	app.Get("", "/metrics", metrics.WebHandler())
+//
+// It is declared without the web package so that packages recording metrics
+// do not depend on the HTTP layer.
+func WebHandler() func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	h := Handler()
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		h.ServeHTTP(w, r)
+		return nil
+	}
+}
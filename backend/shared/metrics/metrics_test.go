@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestWebHandler(t *testing.T) {
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_requests_total", Help: "Test requests."})
+	Registry.MustRegister(counter)
+	defer Registry.Unregister(counter)
+	counter.Inc()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	if err := WebHandler()(context.Background(), w, r); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	body := w.Body.String()
+	for _, want := range []string{"test_requests_total 1", "go_goroutines"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Want %q in metrics, got %s", want, body)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Package trace propagates W3C trace IDs across HTTP requests and events
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// TraceparentHeader is the W3C Trace Context header carrying the trace ID
+// across HTTP requests and events
+const TraceparentHeader = "traceparent"
+
+// NewTraceID returns a random 32 character W3C trace ID
+func NewTraceID() string {
+	return randomHex(16)
+}
+
+type ctxKey int
+
+const traceIDKey ctxKey = 1
+
+// WithTraceID returns a context carrying traceID
+func WithTraceID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, traceIDKey, traceID)
+}
+
+// TraceIDFromContext returns the trace ID set by WithTraceID, or ""
+func TraceIDFromContext(ctx context.Context) string {
+	traceID, _ := ctx.Value(traceIDKey).(string)
+	return traceID
+}
+
+// ParseTraceparent returns the trace ID of a W3C traceparent value
+func ParseTraceparent(value string) (string, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return "", false
+	}
+	if !isHex(parts[1], 32) || !isHex(parts[2], 16) || parts[1] == strings.Repeat("0", 32) {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// FormatTraceparent returns a sampled W3C traceparent value for traceID with
+// a new span ID. Trace IDs in UUID form are accepted with their dashes
+// removed; other malformed IDs yield "".
+func FormatTraceparent(traceID string) string {
+	traceID = strings.ToLower(strings.ReplaceAll(traceID, "-", ""))
+	if !isHex(traceID, 32) {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-01", traceID, randomHex(8))
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, r := range s {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,56 @@
+package trace
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+		ok    bool
+	}{
+		{"valid", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736", true},
+		{"empty", "", "", false},
+		{"invalid version", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "", false},
+		{"zero trace", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", "", false},
+		{"uppercase", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", "", false},
+		{"short span", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa-01", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseTraceparent(tt.value)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("Want %q, %v, got %q, %v", tt.want, tt.ok, got, ok)
+			}
+		})
+	}
+}
+
+func TestFormatTraceparent(t *testing.T) {
+	traceID := NewTraceID()
+	if got, ok := ParseTraceparent(FormatTraceparent(traceID)); !ok || got != traceID {
+		t.Errorf("Want trace %q to round-trip, got %q", traceID, got)
+	}
+
+	// Trace IDs in UUID form are accepted
+	if got, ok := ParseTraceparent(FormatTraceparent("4bf92f35-77b3-4da6-a3ce-929d0e0e4736")); !ok || got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Want UUID trace to be accepted, got %q", got)
+	}
+	if got := FormatTraceparent("not-a-trace"); got != "" {
+		t.Errorf("Want no traceparent for malformed trace, got %q", got)
+	}
+}
+
+func TestTraceIDFromContext(t *testing.T) {
+	if got := TraceIDFromContext(context.Background()); got != "" {
+		t.Errorf("Want no trace ID, got %q", got)
+	}
+	ctx := WithTraceID(context.Background(), "4bf92f3577b34da6a3ce929d0e0e4736")
+	if got := TraceIDFromContext(ctx); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Want the trace ID, got %q", got)
+	}
+}
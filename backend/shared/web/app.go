@@ -4,7 +4,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/SteinerLabs/lms/backend/shared/log"
-	"github.com/google/uuid"
+	"github.com/SteinerLabs/lms/backend/shared/trace"
 	"net/http"
 	"time"
 )
@@ -69,16 +69,21 @@ func (a *App) Handle(method string, group string, path string, handler Handler,
 	h := func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
+		traceID, ok := trace.ParseTraceparent(r.Header.Get(trace.TraceparentHeader))
+		if !ok {
+			traceID = trace.NewTraceID()
+		}
+
 		v := Values{
-			TraceID: uuid.New().String(),
+			TraceID: traceID,
 			Now:     time.Now(),
 		}
 
 		ctx = context.WithValue(ctx, key, &v)
+		ctx = trace.WithTraceID(ctx, traceID)
 
 		if err := handler(ctx, w, r); err != nil {
-			a.log.Error("web-respond", "error", err, "path", path, "method", method, "group", group)
-			return
+			a.respondError(ctx, w, &v, err, method, group, path)
 		}
 	}
 
@@ -91,6 +96,25 @@ func (a *App) Handle(method string, group string, path string, handler Handler,
 	a.mux.HandleFunc(finalPath, h)
 }
 
+// respondError converts an error returned by a handler into the standard
+// error response, unless the handler already responded
+func (a *App) respondError(ctx context.Context, w http.ResponseWriter, v *Values, err error, method, group, path string) {
+	if v.StatusCode != 0 {
+		a.log.Error("web-respond", "error", err, "status", v.StatusCode, "path", path, "method", method, "group", group)
+		return
+	}
+
+	status, respErr := RespondError(ctx, w, err)
+	if status >= http.StatusInternalServerError {
+		a.log.Error("web-respond", "error", err, "status", status, "path", path, "method", method, "group", group)
+	} else {
+		a.log.Info("web-respond", "error", err, "status", status, "path", path, "method", method, "group", group)
+	}
+	if respErr != nil {
+		a.log.Error("web-respond", "error", respErr, "path", path, "method", method, "group", group)
+	}
+}
+
 func (a *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	a.mux.ServeHTTP(w, r)
 }
@@ -0,0 +1,229 @@
+package web
+
+import (
+	"encoding"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+	timeType            = reflect.TypeFor[time.Time]()
+	durationType        = reflect.TypeFor[time.Duration]()
+	uuidType            = reflect.TypeFor[uuid.UUID]()
+)
+
+// Bind fills the fields of the struct v points to from the path values,
+// query parameters and headers of r, and then validates v like Validate does,
+// naming fields by their path, query or header name:
+//
+//	type listLessons struct {
+//		CourseID uuid.UUID `path:"course_id"`
+//		Status   []string  `query:"status" enum:"draft,published"`
+//		Page     int       `query:"page" default:"1" validate:"min=1"`
+//		Since    *time.Time `query:"since"`
+//		Tenant   string    `header:"X-Tenant-ID"`
+//	}
+//
+// Fields may be strings, bools, ints, uints, floats, time.Duration,
+// time.Time in RFC 3339 or as a date, uuid.UUID, types implementing
+// encoding.TextUnmarshaler, pointers to these for optional values, and slices
+// of these, filled from repeated or comma separated values. The enum tag
+// restricts the accepted values, and the default tag is used when the value
+// is missing. Values that cannot be bound are reported together in one 400
+// response.
+func Bind(r *http.Request, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("bind target must be a pointer to a struct, got %T", v)
+	}
+
+	var errs FieldErrors
+	if err := bindStruct(r, rv.Elem(), &errs); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return NewError(http.StatusBadRequest, "Invalid request parameters").WithDetails(errs)
+	}
+	return validate(v, bindName)
+}
+
+func bindStruct(r *http.Request, rv reflect.Value, errs *FieldErrors) error {
+	query := r.URL.Query()
+	rt := rv.Type()
+	for i := range rt.NumField() {
+		field := rt.Field(i)
+		fv := rv.Field(i)
+		if field.Anonymous && fv.Kind() == reflect.Struct && !hasBindTag(field) {
+			// Fields of embedded structs are promoted
+			if err := bindStruct(r, fv, errs); err != nil {
+				return err
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		var name string
+		var values []string
+		if name = field.Tag.Get("path"); name != "" {
+			if value := r.PathValue(name); value != "" {
+				values = []string{value}
+			}
+		} else if name = field.Tag.Get("query"); name != "" {
+			values = query[name]
+		} else if name = field.Tag.Get("header"); name != "" {
+			values = r.Header.Values(name)
+		} else {
+			continue
+		}
+
+		if len(values) == 0 {
+			def := field.Tag.Get("default")
+			if def == "" {
+				continue
+			}
+			values = []string{def}
+		}
+
+		var enum []string
+		if tag := field.Tag.Get("enum"); tag != "" {
+			enum = strings.Split(tag, ",")
+		}
+		reason, err := bindField(fv, values, enum)
+		if err != nil {
+			return fmt.Errorf("failed to bind field %s: %w", field.Name, err)
+		}
+		if reason != "" {
+			*errs = append(*errs, FieldError{Field: name, Reason: reason})
+		}
+	}
+	return nil
+}
+
+func hasBindTag(field reflect.StructField) bool {
+	return field.Tag.Get("path") != "" || field.Tag.Get("query") != "" || field.Tag.Get("header") != ""
+}
+
+// bindName returns the path, query or header name of field, or its JSON name
+// if it is not bound
+func bindName(field reflect.StructField) string {
+	for _, tag := range []string{"path", "query", "header"} {
+		if name := field.Tag.Get(tag); name != "" {
+			return name
+		}
+	}
+	return jsonName(field)
+}
+
+// bindField sets fv from values and returns why they are invalid, or "" if
+// they were bound
+func bindField(fv reflect.Value, values []string, enum []string) (string, error) {
+	if fv.Kind() != reflect.Slice || fv.Type().Implements(textUnmarshalerType) {
+		return bindValue(fv, values[0], enum)
+	}
+
+	var items []string
+	for _, value := range values {
+		for item := range strings.SplitSeq(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	slice := reflect.MakeSlice(fv.Type(), len(items), len(items))
+	for i, item := range items {
+		if reason, err := bindValue(slice.Index(i), item, enum); reason != "" || err != nil {
+			return reason, err
+		}
+	}
+	fv.Set(slice)
+	return "", nil
+}
+
+// bindValue parses value into fv
+func bindValue(fv reflect.Value, value string, enum []string) (string, error) {
+	if enum != nil && !slices.Contains(enum, value) {
+		return "must be one of " + strings.Join(enum, ", "), nil
+	}
+
+	if fv.Kind() == reflect.Pointer {
+		ptr := reflect.New(fv.Type().Elem())
+		reason, err := bindValue(ptr.Elem(), value, nil)
+		if reason == "" && err == nil {
+			fv.Set(ptr)
+		}
+		return reason, err
+	}
+
+	switch fv.Type() {
+	case timeType:
+		for _, layout := range []string{time.RFC3339, time.DateOnly} {
+			if t, err := time.Parse(layout, value); err == nil {
+				fv.Set(reflect.ValueOf(t))
+				return "", nil
+			}
+		}
+		return "must be an RFC 3339 time or a date", nil
+	case durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return "must be a duration such as 90s", nil
+		}
+		fv.SetInt(int64(d))
+		return "", nil
+	case uuidType:
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return "must be a valid UUID", nil
+		}
+		fv.Set(reflect.ValueOf(id))
+		return "", nil
+	}
+	if u, ok := fv.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		if err := u.UnmarshalText([]byte(value)); err != nil {
+			return "is invalid: " + err.Error(), nil
+		}
+		return "", nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "must be true or false", nil
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, fv.Type().Bits())
+		if err != nil {
+			return "must be an integer", nil
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, fv.Type().Bits())
+		if err != nil {
+			return "must be a non-negative integer", nil
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, fv.Type().Bits())
+		if err != nil {
+			return "must be a number", nil
+		}
+		fv.SetFloat(n)
+	default:
+		return "", fmt.Errorf("unsupported type %s", fv.Type())
+	}
+	return "", nil
+}
@@ -0,0 +1,152 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type courseStatus string
+
+func (s *courseStatus) UnmarshalText(text []byte) error {
+	switch courseStatus(text) {
+	case "draft", "published", "archived":
+		*s = courseStatus(text)
+		return nil
+	}
+	return fmt.Errorf("unknown status %q", text)
+}
+
+type paging struct {
+	Page    int `query:"page" default:"1" validate:"min=1"`
+	PerPage int `query:"per_page" default:"20" validate:"max=100"`
+}
+
+type listLessons struct {
+	paging
+	CourseID  uuid.UUID      `path:"course_id"`
+	Status    courseStatus   `query:"status" default:"published"`
+	Types     []string       `query:"type" enum:"video,quiz,text"`
+	Since     *time.Time     `query:"since"`
+	Until     time.Time      `query:"until"`
+	Timeout   time.Duration  `query:"timeout"`
+	Completed *bool          `query:"completed"`
+	Score     float64        `query:"min_score"`
+	Statuses  []courseStatus `query:"statuses"`
+	Tenant    string         `header:"X-Tenant-ID" validate:"max=20"`
+}
+
+func bindRequest(target string, header http.Header, courseID string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	r.SetPathValue("course_id", courseID)
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	return r
+}
+
+func TestBind(t *testing.T) {
+	courseID := "4bf92f35-77b3-4da6-a3ce-929d0e0e4736"
+	target := "/courses/" + courseID + "/lessons?page=3&status=draft&type=video,quiz&type=text&since=2030-01-01T09:00:00Z" +
+		"&until=2030-02-01&timeout=90s&completed=true&min_score=0.5&statuses=draft,archived"
+	r := bindRequest(target, http.Header{"X-Tenant-Id": {"school-1"}}, courseID)
+
+	var req listLessons
+	if err := Bind(r, &req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	since := time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)
+	switch {
+	case req.CourseID.String() != courseID:
+		t.Errorf("Want course %s, got %s", courseID, req.CourseID)
+	case req.Page != 3 || req.PerPage != 20:
+		t.Errorf("Want page 3 of 20, got %d of %d", req.Page, req.PerPage)
+	case req.Status != "draft" || !slices.Equal(req.Statuses, []courseStatus{"draft", "archived"}):
+		t.Errorf("Want status draft and statuses draft, archived, got %s and %v", req.Status, req.Statuses)
+	case !slices.Equal(req.Types, []string{"video", "quiz", "text"}):
+		t.Errorf("Want types video, quiz, text, got %v", req.Types)
+	case req.Since == nil || !req.Since.Equal(since) || !req.Until.Equal(time.Date(2030, 2, 1, 0, 0, 0, 0, time.UTC)):
+		t.Errorf("Want since %s until 2030-02-01, got %v until %s", since, req.Since, req.Until)
+	case req.Timeout != 90*time.Second || req.Completed == nil || !*req.Completed || req.Score != 0.5:
+		t.Errorf("Want timeout 90s, completed and score 0.5, got %s, %v and %v", req.Timeout, req.Completed, req.Score)
+	case req.Tenant != "school-1":
+		t.Errorf("Want tenant school-1, got %q", req.Tenant)
+	}
+}
+
+func TestBind_Defaults(t *testing.T) {
+	var req listLessons
+	if err := Bind(bindRequest("/lessons", nil, ""), &req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if req.Page != 1 || req.PerPage != 20 || req.Status != "published" || req.Since != nil || req.Completed != nil || req.Types != nil {
+		t.Errorf("Want defaults, got %+v", req)
+	}
+}
+
+// respondFields writes the error response for err and returns its status
+// and the fields named in its details
+func respondFields(t *testing.T, err error) (int, []string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	if _, err := RespondError(context.Background(), w, err); err != nil {
+		t.Fatal(err)
+	}
+	var resp struct {
+		Error struct {
+			Details []FieldError `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	var fields []string
+	for _, e := range resp.Error.Details {
+		fields = append(fields, e.Field)
+	}
+	return w.Code, fields
+}
+
+func TestBind_Errors(t *testing.T) {
+	target := "/lessons?page=two&status=deleted&type=video,audio&since=yesterday&timeout=soon&completed=maybe&min_score=high"
+	var req listLessons
+	err := Bind(bindRequest(target, nil, "c1"), &req)
+
+	status, got := respondFields(t, err)
+	if status != http.StatusBadRequest {
+		t.Fatalf("Want a 400 error, got %v", err)
+	}
+	want := []string{"page", "course_id", "status", "type", "since", "timeout", "completed", "min_score"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Want errors for %v, got %v", want, got)
+	}
+	var webErr *Error
+	if !errors.As(err, &webErr) || !strings.Contains(fmt.Sprint(webErr.Details), "type: must be one of video, quiz, text") {
+		t.Errorf("Want the enum values in the reason, got %v", err)
+	}
+
+	// Bound values are validated and named like when they fail to bind
+	header := http.Header{"X-Tenant-Id": {strings.Repeat("x", 21)}}
+	err = Bind(bindRequest("/lessons?per_page=500", header, ""), &req)
+	status, got = respondFields(t, err)
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("Want FieldErrors, got %v", err)
+	}
+	if want := []string{"per_page", "X-Tenant-ID"}; !slices.Equal(got, want) {
+		t.Errorf("Want errors for %v, got %v", want, got)
+	}
+
+	if err := Bind(bindRequest("/lessons", nil, ""), req); err == nil || ErrorStatus(err) != http.StatusInternalServerError {
+		t.Errorf("Want an error for a non-pointer target, got %v", err)
+	}
+}
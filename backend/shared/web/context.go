@@ -14,6 +14,10 @@ type Values struct {
 	TraceID    string
 	Now        time.Time
 	StatusCode int
+
+	// Set by the authentication middleware
+	UserID      string
+	Permissions []string
 }
 
 func GetValues(ctx context.Context) (*Values, error) {
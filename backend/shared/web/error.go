@@ -1,8 +1,56 @@
 package web
 
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Error codes of the standard error response, as listed in
+// docs/architecture/api/api_gateway.md
+const (
+	CodeBadRequest         = "BAD_REQUEST"
+	CodeUnauthorized       = "UNAUTHORIZED"
+	CodeForbidden          = "FORBIDDEN"
+	CodeNotFound           = "NOT_FOUND"
+	CodeConflict           = "CONFLICT"
+	CodeValidationError    = "VALIDATION_ERROR"
+	CodeRateLimited        = "RATE_LIMITED"
+	CodeInternalError      = "INTERNAL_ERROR"
+	CodeServiceUnavailable = "SERVICE_UNAVAILABLE"
+	CodeRequestCanceled    = "REQUEST_CANCELED"
+	CodePayloadTooLarge    = "PAYLOAD_TOO_LARGE"
+	CodeUnsupportedMedia   = "UNSUPPORTED_MEDIA_TYPE"
+)
+
+// StatusClientClosedRequest is reported when the client went away before the
+// handler finished, so that such requests are not counted as server errors
+const StatusClientClosedRequest = 499
+
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            CodeBadRequest,
+	http.StatusUnauthorized:          CodeUnauthorized,
+	http.StatusForbidden:             CodeForbidden,
+	http.StatusNotFound:              CodeNotFound,
+	http.StatusConflict:              CodeConflict,
+	http.StatusUnprocessableEntity:   CodeValidationError,
+	http.StatusRequestEntityTooLarge: CodePayloadTooLarge,
+	http.StatusUnsupportedMediaType:  CodeUnsupportedMedia,
+	http.StatusTooManyRequests:       CodeRateLimited,
+	http.StatusInternalServerError:   CodeInternalError,
+	http.StatusServiceUnavailable:    CodeServiceUnavailable,
+	StatusClientClosedRequest:        CodeRequestCanceled,
+}
+
+// Error is an error with a status and message that are safe to show to
+// clients. Handlers return it to respond with the standard error format.
 type Error struct {
-	Status  int    `json:"-"`
-	Message string `json:"error"`
+	Status  int    // Defaults to 500
+	Code    string // Defaults to the code of Status
+	Message string
+	Details any // Optional, encoded as JSON
 }
 
 func NewError(code int, message string) *Error {
@@ -12,6 +60,109 @@ func NewError(code int, message string) *Error {
 	}
 }
 
+// WithDetails sets the details of the error response and returns e
+func (e *Error) WithDetails(details any) *Error {
+	e.Details = details
+	return e
+}
+
 func (e *Error) Error() string {
 	return e.Message
 }
+
+// FieldError reports why a field of a request is invalid
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// FieldErrors is returned when a request fails validation. It responds with
+// 422 and the invalid fields as details.
+type FieldErrors []FieldError
+
+func (fe FieldErrors) Error() string {
+	reasons := make([]string, len(fe))
+	for i, e := range fe {
+		reasons[i] = e.Field + ": " + e.Reason
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// ErrorResponse is the standard error response of all services
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+	Meta  ErrorMeta `json:"meta"`
+}
+
+type ErrorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Details any    `json:"details,omitempty"`
+}
+
+type ErrorMeta struct {
+	Timestamp time.Time `json:"timestamp"`
+	RequestID string    `json:"request_id"` // The trace ID of the request
+}
+
+// toError maps err to the error reported to the client. Errors that are not
+// an *Error or FieldErrors are reported as internal errors without their
+// message.
+func toError(err error) *Error {
+	var webErr *Error
+	var fieldErrs FieldErrors
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &webErr):
+		e := *webErr
+		if e.Status == 0 {
+			e.Status = http.StatusInternalServerError
+		}
+		if e.Code == "" {
+			e.Code = statusCode(e.Status)
+		}
+		return &e
+	case errors.As(err, &fieldErrs):
+		return &Error{Status: http.StatusUnprocessableEntity, Code: CodeValidationError, Message: "Request validation failed", Details: fieldErrs}
+	case errors.As(err, &maxBytesErr):
+		return &Error{Status: http.StatusRequestEntityTooLarge, Code: CodePayloadTooLarge, Message: "Request body too large"}
+	case errors.Is(err, context.Canceled):
+		return &Error{Status: StatusClientClosedRequest, Code: CodeRequestCanceled, Message: "Request was canceled"}
+	case errors.Is(err, context.DeadlineExceeded):
+		return &Error{Status: http.StatusServiceUnavailable, Code: CodeServiceUnavailable, Message: "Request timed out"}
+	default:
+		return &Error{Status: http.StatusInternalServerError, Code: CodeInternalError, Message: http.StatusText(http.StatusInternalServerError)}
+	}
+}
+
+// statusCode returns the error code of status. Statuses without a code of
+// their own fall back to the code of their class.
+func statusCode(status int) string {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	if status < http.StatusInternalServerError {
+		return CodeBadRequest
+	}
+	return CodeInternalError
+}
+
+// ErrorStatus returns the status of the response RespondError writes for err
+func ErrorStatus(err error) int {
+	return toError(err).Status
+}
+
+// RespondError writes the standard error response for err and returns its
+// status
+func RespondError(ctx context.Context, w http.ResponseWriter, err error) (int, error) {
+	e := toError(err)
+
+	resp := ErrorResponse{
+		Error: ErrorBody{Code: e.Code, Message: e.Message, Details: e.Details},
+		Meta:  ErrorMeta{Timestamp: time.Now().UTC()},
+	}
+	if v, err := GetValues(ctx); err == nil {
+		resp.Meta.RequestID = v.TraceID
+	}
+	return e.Status, Encode(ctx, w, resp, e.Status)
+}
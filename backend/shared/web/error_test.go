@@ -0,0 +1,81 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SteinerLabs/lms/backend/shared/log"
+	"github.com/SteinerLabs/lms/backend/shared/trace"
+)
+
+func TestApp_ErrorResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+		wantMsg    string
+	}{
+		{"web error", NewError(http.StatusNotFound, "Course not found"), http.StatusNotFound, CodeNotFound, "Course not found"},
+		{"wrapped web error", fmt.Errorf("failed to load course: %w", NewError(http.StatusConflict, "Course was modified")), http.StatusConflict, CodeConflict, "Course was modified"},
+		{"custom code", &Error{Status: http.StatusBadRequest, Code: "INVALID_CURSOR", Message: "Invalid cursor"}, http.StatusBadRequest, "INVALID_CURSOR", "Invalid cursor"},
+		{"missing status", &Error{Message: "Course is locked"}, http.StatusInternalServerError, CodeInternalError, "Course is locked"},
+		{"unmapped client status", NewError(http.StatusMethodNotAllowed, "Courses cannot be patched"), http.StatusMethodNotAllowed, CodeBadRequest, "Courses cannot be patched"},
+		{"unmapped server status", NewError(http.StatusBadGateway, "Payment provider failed"), http.StatusBadGateway, CodeInternalError, "Payment provider failed"},
+		{"validation", FieldErrors{{Field: "username", Reason: "must be at least 3 characters"}}, http.StatusUnprocessableEntity, CodeValidationError, "Request validation failed"},
+		{"canceled", fmt.Errorf("failed to query courses: %w", context.Canceled), StatusClientClosedRequest, CodeRequestCanceled, "Request was canceled"},
+		{"timeout", context.DeadlineExceeded, http.StatusServiceUnavailable, CodeServiceUnavailable, "Request timed out"},
+		{"unknown", errors.New("connection refused"), http.StatusInternalServerError, CodeInternalError, "Internal Server Error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := NewApp(log.New(log.WithOutput(io.Discard)))
+			app.Get("", "/courses", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+				return tt.err
+			})
+
+			traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/courses", nil)
+			r.Header.Set(trace.TraceparentHeader, traceparent)
+			app.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Want status %d, got %d", tt.wantStatus, w.Code)
+			}
+			var resp ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if resp.Error.Code != tt.wantCode || resp.Error.Message != tt.wantMsg {
+				t.Errorf("Want %s %q, got %s %q", tt.wantCode, tt.wantMsg, resp.Error.Code, resp.Error.Message)
+			}
+			if resp.Meta.RequestID != "4bf92f3577b34da6a3ce929d0e0e4736" || resp.Meta.Timestamp.IsZero() {
+				t.Errorf("Want meta with the trace ID, got %+v", resp.Meta)
+			}
+		})
+	}
+}
+
+func TestApp_ErrorAfterResponse(t *testing.T) {
+	app := NewApp(log.New(log.WithOutput(io.Discard)))
+	app.Get("", "/courses", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		if err := Encode(ctx, w, []string{}, http.StatusOK); err != nil {
+			return err
+		}
+		return errors.New("failed to write audit log")
+	})
+
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/courses", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "[]" {
+		t.Errorf("Want the handler's response, got %d %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,99 @@
+package mid
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/SteinerLabs/lms/backend/shared/web"
+)
+
+// ErrInvalidToken is returned by a TokenValidator for tokens that are
+// malformed, expired or not signed by the auth service. Other errors, such as
+// an unreachable auth service, are not reported to the client as 401.
+var ErrInvalidToken = errors.New("invalid token")
+
+// Claims identify the user of an authenticated request
+type Claims struct {
+	UserID      string
+	Permissions []string
+}
+
+// TokenValidator validates the bearer tokens issued by the auth service
+type TokenValidator interface {
+	ValidateToken(ctx context.Context, token string) (Claims, error)
+}
+
+// TokenValidatorFunc adapts a function to a TokenValidator
+type TokenValidatorFunc func(ctx context.Context, token string) (Claims, error)
+
+func (f TokenValidatorFunc) ValidateToken(ctx context.Context, token string) (Claims, error) {
+	return f(ctx, token)
+}
+
+// Authenticate requires an Authorization: Bearer token that validator
+// accepts, and stores the user ID and permissions of the token in
+// web.Values. Requests without a valid token fail with 401.
+func Authenticate(validator TokenValidator) web.Middleware {
+	return func(handler web.Handler) web.Handler {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			token, ok := bearerToken(r)
+			if !ok {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				return web.NewError(http.StatusUnauthorized, "Missing bearer token")
+			}
+
+			claims, err := validator.ValidateToken(ctx, token)
+			if errors.Is(err, ErrInvalidToken) {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				return web.NewError(http.StatusUnauthorized, "Invalid or expired token")
+			}
+			if err != nil {
+				return err
+			}
+
+			v, err := web.GetValues(ctx)
+			if err != nil {
+				return err
+			}
+			v.UserID = claims.UserID
+			v.Permissions = claims.Permissions
+			return handler(ctx, w, r)
+		}
+	}
+}
+
+// RequirePermission lets only users with all of the given permissions pass.
+// It runs after Authenticate and fails with 401 for anonymous requests and
+// with 403 for users missing a permission.
+func RequirePermission(permissions ...string) web.Middleware {
+	return func(handler web.Handler) web.Handler {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			v, err := web.GetValues(ctx)
+			if err != nil {
+				return err
+			}
+			if v.UserID == "" {
+				return web.NewError(http.StatusUnauthorized, "Authentication required")
+			}
+			for _, permission := range permissions {
+				if !slices.Contains(v.Permissions, permission) {
+					return web.NewError(http.StatusForbidden, "Missing permission "+permission)
+				}
+			}
+			return handler(ctx, w, r)
+		}
+	}
+}
+
+// bearerToken returns the token of the Authorization header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
@@ -0,0 +1,214 @@
+package mid
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/SteinerLabs/lms/backend/shared/log"
+	"github.com/SteinerLabs/lms/backend/shared/web"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var secret = []byte("test-secret")
+
+func signToken(t *testing.T, key []byte, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestJWTValidator(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+	tests := []struct {
+		name    string
+		token   string
+		want    Claims
+		invalid bool
+	}{
+		{
+			name:  "valid",
+			token: signToken(t, secret, jwt.MapClaims{"sub": "u1", "iss": "lms-auth-service", "exp": exp, "permissions": []string{"course:read"}}),
+			want:  Claims{UserID: "u1", Permissions: []string{"course:read"}},
+		},
+		{
+			name:  "without permissions",
+			token: signToken(t, secret, jwt.MapClaims{"sub": "u1", "iss": "lms-auth-service", "exp": exp}),
+			want:  Claims{UserID: "u1"},
+		},
+		{
+			name:    "expired",
+			token:   signToken(t, secret, jwt.MapClaims{"sub": "u1", "iss": "lms-auth-service", "exp": time.Now().Add(-time.Minute).Unix()}),
+			invalid: true,
+		},
+		{
+			name:    "wrong key",
+			token:   signToken(t, []byte("other-secret"), jwt.MapClaims{"sub": "u1", "iss": "lms-auth-service", "exp": exp}),
+			invalid: true,
+		},
+		{
+			name:    "wrong issuer",
+			token:   signToken(t, secret, jwt.MapClaims{"sub": "u1", "iss": "someone-else", "exp": exp}),
+			invalid: true,
+		},
+		{
+			name:    "malformed",
+			token:   "not-a-token",
+			invalid: true,
+		},
+	}
+
+	v := NewJWTValidator(StaticKey(secret), WithIssuer("lms-auth-service"))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := v.ValidateToken(context.Background(), tt.token)
+			if tt.invalid {
+				if !errors.Is(err, ErrInvalidToken) {
+					t.Errorf("Want ErrInvalidToken, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if claims.UserID != tt.want.UserID || !slices.Equal(claims.Permissions, tt.want.Permissions) {
+				t.Errorf("Want %+v, got %+v", tt.want, claims)
+			}
+		})
+	}
+}
+
+func TestJWTValidator_KeyCache(t *testing.T) {
+	fetches := 0
+	source := func(ctx context.Context) (map[string]any, error) {
+		fetches++
+		if fetches > 1 {
+			return nil, errors.New("auth service unavailable")
+		}
+		return map[string]any{"": secret}, nil
+	}
+	v := NewJWTValidator(source, WithKeyTTL(time.Hour))
+
+	token := signToken(t, secret, jwt.MapClaims{"sub": "u1", "exp": time.Now().Add(time.Hour).Unix()})
+	for range 3 {
+		if _, err := v.ValidateToken(context.Background(), token); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("Want keys fetched once, got %d", fetches)
+	}
+
+	// Expired keys are kept while the source fails, and the source is not
+	// called again until the retry interval passed
+	v.ttl = 0
+	for range 3 {
+		if _, err := v.ValidateToken(context.Background(), token); err != nil {
+			t.Errorf("Want the cached key to be used, got %v", err)
+		}
+	}
+	if fetches != 2 {
+		t.Errorf("Want one failed fetch, got %d", fetches-1)
+	}
+	v.failed = time.Now().Add(-time.Minute)
+	if _, err := v.ValidateToken(context.Background(), token); err != nil {
+		t.Errorf("Want the cached key to be used, got %v", err)
+	}
+	if fetches != 3 {
+		t.Errorf("Want the keys fetched again after the retry interval, got %d fetches", fetches)
+	}
+}
+
+func TestJWTValidator_SourceUnavailable(t *testing.T) {
+	fetches := 0
+	source := func(ctx context.Context) (map[string]any, error) {
+		fetches++
+		return nil, errors.New("auth service unavailable")
+	}
+	v := NewJWTValidator(source)
+
+	token := signToken(t, secret, jwt.MapClaims{"sub": "u1", "exp": time.Now().Add(time.Hour).Unix()})
+	for range 3 {
+		if _, err := v.ValidateToken(context.Background(), token); err == nil || errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Want the fetch error, got %v", err)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("Want keys fetched once within the retry interval, got %d", fetches)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	validator := NewJWTValidator(StaticKey(secret))
+	unavailable := TokenValidatorFunc(func(ctx context.Context, token string) (Claims, error) {
+		return Claims{}, errors.New("auth service unavailable")
+	})
+
+	newApp := func(validator TokenValidator) *web.App {
+		app := web.NewApp(log.New(log.WithOutput(io.Discard)), Authenticate(validator))
+		app.Put("", "/courses/{id}", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			v, _ := web.GetValues(ctx)
+			return web.Encode(ctx, w, map[string]string{"user_id": v.UserID}, http.StatusOK)
+		}, RequirePermission("course:update"))
+		return app
+	}
+
+	exp := time.Now().Add(time.Hour).Unix()
+	editor := signToken(t, secret, jwt.MapClaims{"sub": "u1", "exp": exp, "permissions": []string{"course:read", "course:update"}})
+	reader := signToken(t, secret, jwt.MapClaims{"sub": "u2", "exp": exp, "permissions": []string{"course:read"}})
+
+	tests := []struct {
+		name          string
+		validator     TokenValidator
+		authorization string
+		want          int
+	}{
+		{"permitted", validator, "Bearer " + editor, http.StatusOK},
+		{"missing permission", validator, "Bearer " + reader, http.StatusForbidden},
+		{"missing token", validator, "", http.StatusUnauthorized},
+		{"basic auth", validator, "Basic dTE6c2VjcmV0", http.StatusUnauthorized},
+		{"invalid token", validator, "Bearer " + editor + "x", http.StatusUnauthorized},
+		{"validator unavailable", unavailable, "Bearer " + editor, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newApp(tt.validator)
+			w := serveWith(app, http.MethodPut, "/courses/c1", tt.authorization)
+			if w.Code != tt.want {
+				t.Errorf("Want status %d, got %d: %s", tt.want, w.Code, w.Body)
+			}
+			if tt.want == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("Want a WWW-Authenticate challenge")
+			}
+		})
+	}
+}
+
+func TestRequirePermission_Anonymous(t *testing.T) {
+	app := web.NewApp(log.New(log.WithOutput(io.Discard)))
+	app.Delete("", "/courses/{id}", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		return nil
+	}, RequirePermission("course:delete"))
+
+	if w := serveWith(app, http.MethodDelete, "/courses/c1", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Want status 401, got %d", w.Code)
+	}
+}
+
+func serveWith(app *web.App, method, target, authorization string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, target, nil)
+	if authorization != "" {
+		r.Header.Set("Authorization", authorization)
+	}
+	app.ServeHTTP(w, r)
+	return w
+}
@@ -0,0 +1,23 @@
+package mid
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/SteinerLabs/lms/backend/shared/web"
+)
+
+// MaxBodySize rejects requests whose body exceeds n bytes with 413. Bodies
+// without a declared length fail with *http.MaxBytesError once n bytes have
+// been read.
+func MaxBodySize(n int64) web.Middleware {
+	return func(handler web.Handler) web.Handler {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			if r.ContentLength > n {
+				return web.NewError(http.StatusRequestEntityTooLarge, "Request body too large")
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, n)
+			return handler(ctx, w, r)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package mid
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// validateTokenMethod is the full name of the auth service's ValidateToken
+// RPC, as declared in services/auth/proto/auth.proto
+const validateTokenMethod = "/auth.AuthService/ValidateToken"
+
+// AuthServiceValidator validates tokens by calling the auth service's
+// ValidateToken RPC, so that revoked tokens are rejected and permissions are
+// read from the auth service. Every request costs a call; use JWTValidator
+// where tokens carry their permissions.
+type AuthServiceValidator struct {
+	conn grpc.ClientConnInterface
+}
+
+// NewAuthServiceValidator creates a validator calling the auth service over
+// conn
+func NewAuthServiceValidator(conn grpc.ClientConnInterface) *AuthServiceValidator {
+	return &AuthServiceValidator{conn: conn}
+}
+
+// ValidateToken implements TokenValidator
+func (v *AuthServiceValidator) ValidateToken(ctx context.Context, token string) (Claims, error) {
+	var resp validateTokenResponse
+	err := v.conn.Invoke(ctx, validateTokenMethod, &validateTokenRequest{Token: token}, &resp, grpc.ForceCodec(authCodec{}))
+	switch status.Code(err) {
+	case codes.OK:
+	case codes.Unauthenticated, codes.InvalidArgument:
+		return Claims{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	default:
+		return Claims{}, fmt.Errorf("failed to validate token with the auth service: %w", err)
+	}
+	if !resp.Valid || resp.UserID == "" {
+		return Claims{}, ErrInvalidToken
+	}
+	return Claims{UserID: resp.UserID, Permissions: resp.Permissions}, nil
+}
+
+// validateTokenRequest mirrors auth.ValidateTokenRequest. The shared module
+// cannot import the auth service's generated code, so the messages are
+// encoded by hand.
+type validateTokenRequest struct {
+	Token string // Field 1
+}
+
+// validateTokenResponse mirrors auth.ValidateTokenResponse
+type validateTokenResponse struct {
+	Valid       bool     // Field 1
+	UserID      string   // Field 2
+	Permissions []string // Field 3
+}
+
+// authCodec encodes the ValidateToken messages in the protobuf wire format
+type authCodec struct{}
+
+func (authCodec) Name() string {
+	return "proto"
+}
+
+func (authCodec) Marshal(v any) ([]byte, error) {
+	req, ok := v.(*validateTokenRequest)
+	if !ok {
+		return nil, fmt.Errorf("cannot marshal %T", v)
+	}
+	var b []byte
+	if req.Token != "" {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, req.Token)
+	}
+	return b, nil
+}
+
+func (authCodec) Unmarshal(data []byte, v any) error {
+	resp, ok := v.(*validateTokenResponse)
+	if !ok {
+		return fmt.Errorf("cannot unmarshal into %T", v)
+	}
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			var valid uint64
+			valid, n = protowire.ConsumeVarint(data)
+			resp.Valid = valid != 0
+		case num == 2 && typ == protowire.BytesType:
+			resp.UserID, n = consumeString(data)
+		case num == 3 && typ == protowire.BytesType:
+			var permission string
+			permission, n = consumeString(data)
+			resp.Permissions = append(resp.Permissions, permission)
+		default:
+			// Fields added to the message later are skipped
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+func consumeString(data []byte) (string, int) {
+	b, n := protowire.ConsumeBytes(data)
+	return string(b), n
+}
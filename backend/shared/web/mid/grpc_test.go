@@ -0,0 +1,81 @@
+package mid
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// fakeAuthService answers ValidateToken in the protobuf wire format, the way
+// the auth service does
+type fakeAuthService struct {
+	grpc.ClientConnInterface
+	users map[string]string // User ID by token
+	err   error
+}
+
+func (s *fakeAuthService) Invoke(ctx context.Context, method string, args any, reply any, opts ...grpc.CallOption) error {
+	if method != "/auth.AuthService/ValidateToken" {
+		return status.Errorf(codes.Unimplemented, "unknown method %s", method)
+	}
+	if s.err != nil {
+		return s.err
+	}
+
+	req, err := authCodec{}.Marshal(args)
+	if err != nil {
+		return err
+	}
+	num, _, n := protowire.ConsumeTag(req)
+	if num != 1 || n < 0 {
+		return status.Error(codes.InvalidArgument, "token is required")
+	}
+	token, _ := protowire.ConsumeBytes(req[n:])
+
+	var resp []byte
+	if userID, ok := s.users[string(token)]; ok {
+		resp = protowire.AppendTag(resp, 1, protowire.VarintType)
+		resp = protowire.AppendVarint(resp, 1)
+		resp = protowire.AppendTag(resp, 2, protowire.BytesType)
+		resp = protowire.AppendString(resp, userID)
+		for _, permission := range []string{"course:read", "course:update"} {
+			resp = protowire.AppendTag(resp, 3, protowire.BytesType)
+			resp = protowire.AppendString(resp, permission)
+		}
+		// A field the validator does not know
+		resp = protowire.AppendTag(resp, 9, protowire.VarintType)
+		resp = protowire.AppendVarint(resp, 7)
+	}
+	return authCodec{}.Unmarshal(resp, reply)
+}
+
+func TestAuthServiceValidator(t *testing.T) {
+	service := &fakeAuthService{users: map[string]string{"token-1": "u1"}}
+	v := NewAuthServiceValidator(service)
+
+	claims, err := v.ValidateToken(context.Background(), "token-1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if claims.UserID != "u1" || !slices.Equal(claims.Permissions, []string{"course:read", "course:update"}) {
+		t.Errorf("Unexpected claims %+v", claims)
+	}
+
+	if _, err := v.ValidateToken(context.Background(), "token-2"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Want ErrInvalidToken for an unknown token, got %v", err)
+	}
+	if _, err := v.ValidateToken(context.Background(), ""); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Want ErrInvalidToken for an empty token, got %v", err)
+	}
+
+	service.err = status.Error(codes.Unavailable, "connection refused")
+	if _, err := v.ValidateToken(context.Background(), "token-1"); err == nil || errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Want an unavailable auth service not to reject the token, got %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package mid
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// KeySource returns the keys tokens may be signed with, by key ID. Tokens
+// without a kid header use the key with the empty ID. Keys are []byte for
+// HMAC, or *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey.
+type KeySource func(ctx context.Context) (map[string]any, error)
+
+// StaticKey is a KeySource with a single key, such as the auth service's
+// HMAC secret
+func StaticKey(key any) KeySource {
+	return func(ctx context.Context) (map[string]any, error) {
+		return map[string]any{"": key}, nil
+	}
+}
+
+// JWTValidator validates tokens locally, without calling the auth service. It
+// takes the user ID from the sub claim and the permissions from the
+// permissions claim, which the auth service sets on access tokens when they
+// are issued; tokens without that claim carry no permissions.
+type JWTValidator struct {
+	source   KeySource
+	ttl      time.Duration
+	retry    time.Duration
+	issuer   string
+	audience string
+
+	mu       sync.Mutex
+	keys     map[string]any
+	fetched  time.Time
+	failed   time.Time // When fetching the keys last failed
+	fetchErr error
+}
+
+// JWTOption configures optional JWTValidator behaviour
+type JWTOption func(*JWTValidator)
+
+// WithIssuer rejects tokens whose iss claim is not issuer
+func WithIssuer(issuer string) JWTOption {
+	return func(v *JWTValidator) {
+		v.issuer = issuer
+	}
+}
+
+// WithAudience rejects tokens whose aud claim does not contain audience
+func WithAudience(audience string) JWTOption {
+	return func(v *JWTValidator) {
+		v.audience = audience
+	}
+}
+
+// WithKeyTTL sets how long keys are cached before they are fetched again. It
+// defaults to five minutes.
+func WithKeyTTL(d time.Duration) JWTOption {
+	return func(v *JWTValidator) {
+		v.ttl = d
+	}
+}
+
+// WithKeyRetryInterval sets how long to wait after a failed fetch before
+// fetching the keys again. Meanwhile the cached keys are used, even when they
+// expired. It defaults to ten seconds.
+func WithKeyRetryInterval(d time.Duration) JWTOption {
+	return func(v *JWTValidator) {
+		v.retry = d
+	}
+}
+
+// minKeyRefresh limits how often a token with an unknown key ID fetches the
+// keys before the cache expires
+const minKeyRefresh = 10 * time.Second
+
+// NewJWTValidator creates a validator for tokens signed with the keys of
+// source
+func NewJWTValidator(source KeySource, opts ...JWTOption) *JWTValidator {
+	v := &JWTValidator{
+		source: source,
+		ttl:    5 * time.Minute,
+		retry:  10 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+type jwtClaims struct {
+	jwt.RegisteredClaims
+	Permissions []string `json:"permissions"`
+}
+
+// ValidateToken implements TokenValidator
+func (v *JWTValidator) ValidateToken(ctx context.Context, token string) (Claims, error) {
+	var keyErr error
+	keyFunc := func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := v.key(ctx, kid)
+		if err != nil {
+			keyErr = err
+			return nil, err
+		}
+		if !keyMatches(t.Method, key) {
+			return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+		}
+		return key, nil
+	}
+
+	opts := []jwt.ParserOption{jwt.WithExpirationRequired()}
+	if v.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(v.issuer))
+	}
+	if v.audience != "" {
+		opts = append(opts, jwt.WithAudience(v.audience))
+	}
+
+	var claims jwtClaims
+	if _, err := jwt.ParseWithClaims(token, &claims, keyFunc, opts...); err != nil {
+		if keyErr != nil {
+			return Claims{}, keyErr
+		}
+		return Claims{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if claims.Subject == "" {
+		return Claims{}, fmt.Errorf("%w: missing subject", ErrInvalidToken)
+	}
+	return Claims{UserID: claims.Subject, Permissions: claims.Permissions}, nil
+}
+
+// key returns the cached key with ID kid, fetching the keys when the cache
+// expired or, at most every minKeyRefresh, when kid is unknown. After a failed
+// fetch the source is not called again for the retry interval, so requests do
+// not queue behind a source that is down.
+func (v *JWTValidator) key(ctx context.Context, kid string) (any, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	age := time.Since(v.fetched)
+	key, ok := v.keys[kid]
+	stale := v.keys == nil || age > v.ttl || (!ok && age > minKeyRefresh)
+	if stale && time.Since(v.failed) > v.retry {
+		keys, err := v.source(ctx)
+		if err != nil {
+			// Keep using the cached keys until the source recovers
+			v.failed, v.fetchErr = time.Now(), err
+		} else {
+			v.keys, v.fetched, v.failed = keys, time.Now(), time.Time{}
+		}
+		key, ok = v.keys[kid]
+	}
+	if v.keys == nil {
+		return nil, fmt.Errorf("failed to fetch signing keys: %w", v.fetchErr)
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidToken, kid)
+	}
+	return key, nil
+}
+
+// keyMatches reports whether tokens signed with method can be verified with
+// key, so that a public key is never used as an HMAC secret
+func keyMatches(method jwt.SigningMethod, key any) bool {
+	switch method.(type) {
+	case *jwt.SigningMethodHMAC:
+		_, ok := key.([]byte)
+		return ok
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		_, ok := key.(*rsa.PublicKey)
+		return ok
+	case *jwt.SigningMethodECDSA:
+		_, ok := key.(*ecdsa.PublicKey)
+		return ok
+	case *jwt.SigningMethodEd25519:
+		_, ok := key.(ed25519.PublicKey)
+		return ok
+	}
+	return false
+}
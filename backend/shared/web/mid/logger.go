@@ -0,0 +1,37 @@
+package mid
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/SteinerLabs/lms/backend/shared/log"
+	"github.com/SteinerLabs/lms/backend/shared/web"
+)
+
+// Logger logs every request once it has been handled, with its status and
+// latency
+func Logger(log *log.Logger) web.Middleware {
+	return func(handler web.Handler) web.Handler {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			err := handler(ctx, w, r)
+
+			v, verr := web.GetValues(ctx)
+			if verr != nil {
+				return err
+			}
+			status := v.StatusCode
+			switch {
+			case status != 0:
+			case err != nil:
+				// The app responds to the error after the middleware returns
+				status = web.ErrorStatus(err)
+			default:
+				status = http.StatusOK
+			}
+			log.Info("request completed", "method", r.Method, "path", r.URL.Path, "status", status,
+				"latency", time.Since(v.Now), "trace_id", v.TraceID, "remote_addr", r.RemoteAddr)
+			return err
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package mid
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SteinerLabs/lms/backend/shared/metrics"
+	"github.com/SteinerLabs/lms/backend/shared/web"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type httpMetrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+var defaultMetrics = sync.OnceValue(func() *httpMetrics {
+	return newHTTPMetrics(metrics.Registry)
+})
+
+func newHTTPMetrics(reg prometheus.Registerer) *httpMetrics {
+	m := &httpMetrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "http",
+			Name:      "requests_total",
+			Help:      "HTTP requests handled, by route pattern and status.",
+		}, []string{"method", "route", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "http",
+			Name:      "request_duration_seconds",
+			Help:      "Time spent handling HTTP requests, by route pattern.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+	}
+	reg.MustRegister(m.requests, m.duration)
+	return m
+}
+
+// Metrics counts requests and measures their duration on metrics.Registry.
+// Requests are labelled by the route pattern they matched, such as
+// /courses/{id}, so that path parameters do not create new series.
+func Metrics() web.Middleware {
+	return metricsMiddleware(defaultMetrics())
+}
+
+func metricsMiddleware(m *httpMetrics) web.Middleware {
+	return func(handler web.Handler) web.Handler {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			start := time.Now()
+			err := handler(ctx, w, r)
+
+			status := http.StatusOK
+			if v, verr := web.GetValues(ctx); verr == nil && v.StatusCode != 0 {
+				status = v.StatusCode
+			} else if err != nil {
+				status = web.ErrorStatus(err)
+			}
+			route := strings.TrimPrefix(r.Pattern, r.Method+" ")
+			m.requests.WithLabelValues(r.Method, route, strconv.Itoa(status)).Inc()
+			m.duration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+			return err
+		}
+	}
+}
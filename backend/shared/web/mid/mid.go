@@ -0,0 +1,21 @@
+// Package mid provides the standard middleware of web.App: panic recovery,
+// access logging, request metrics and request body limits.
+package mid
+
+import (
+	"github.com/SteinerLabs/lms/backend/shared/log"
+	"github.com/SteinerLabs/lms/backend/shared/web"
+)
+
+// Standard returns the standard middleware in the order they must run, for
+// passing to web.NewApp:
+//
+//	app := web.NewApp(log, mid.Standard(log)...)
+func Standard(log *log.Logger) []web.Middleware {
+	return []web.Middleware{
+		Logger(log),
+		Metrics(),
+		MaxBodySize(web.DefaultMaxBodySize),
+		Recover(),
+	}
+}
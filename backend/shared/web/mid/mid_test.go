@@ -0,0 +1,134 @@
+package mid
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/SteinerLabs/lms/backend/shared/log"
+	"github.com/SteinerLabs/lms/backend/shared/trace"
+	"github.com/SteinerLabs/lms/backend/shared/web"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func serve(app *web.App, method, target string, body io.Reader) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, target, body)
+	r.Header.Set(trace.TraceparentHeader, traceparent)
+	app.ServeHTTP(w, r)
+	return w
+}
+
+func TestRecover(t *testing.T) {
+	var logs bytes.Buffer
+	l := log.New(log.WithOutput(&logs), log.WithJson())
+	app := web.NewApp(l, Standard(l)...)
+	app.Get("", "/courses", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		var courses map[string]string
+		courses["c1"] = "Go" // Assignment to a nil map
+		return nil
+	})
+
+	w := serve(app, http.MethodGet, "/courses", nil)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Want status 500, got %d", w.Code)
+	}
+	var resp web.ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if resp.Error.Code != web.CodeInternalError || resp.Meta.RequestID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Want an internal error with the trace ID, got %+v", resp)
+	}
+	if !strings.Contains(logs.String(), "assignment to entry in nil map") {
+		t.Errorf("Want the panic logged, got %s", logs.String())
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var logs bytes.Buffer
+	l := log.New(log.WithOutput(&logs), log.WithJson())
+	app := web.NewApp(l, Logger(l))
+	app.Get("", "/courses/{id}", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		return web.NewError(http.StatusNotFound, "Course not found")
+	})
+
+	serve(app, http.MethodGet, "/courses/c1", nil)
+
+	var entry map[string]any
+	for line := range strings.Lines(logs.String()) {
+		if err := json.Unmarshal([]byte(line), &entry); err == nil && entry["msg"] == "request completed" {
+			break
+		}
+		entry = nil
+	}
+	if entry == nil {
+		t.Fatalf("Want a request log, got %s", logs.String())
+	}
+	if entry["status"] != float64(http.StatusNotFound) || entry["path"] != "/courses/c1" || entry["trace_id"] != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Want status 404 for /courses/c1 with the trace ID, got %v", entry)
+	}
+	if _, ok := entry["latency"]; !ok {
+		t.Errorf("Want latency logged, got %v", entry)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	m := newHTTPMetrics(prometheus.NewRegistry())
+	app := web.NewApp(log.New(log.WithOutput(io.Discard)), metricsMiddleware(m))
+	app.Get("", "/courses/{id}", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		if r.PathValue("id") == "missing" {
+			return web.NewError(http.StatusNotFound, "Course not found")
+		}
+		return web.Encode(ctx, w, map[string]string{"id": r.PathValue("id")}, http.StatusOK)
+	})
+
+	for _, id := range []string{"c1", "c2", "missing"} {
+		serve(app, http.MethodGet, "/courses/"+id, nil)
+	}
+
+	if got := testutil.ToFloat64(m.requests.WithLabelValues(http.MethodGet, "/courses/{id}", "200")); got != 2 {
+		t.Errorf("Want 2 successful requests, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.requests.WithLabelValues(http.MethodGet, "/courses/{id}", "404")); got != 1 {
+		t.Errorf("Want 1 not found request, got %v", got)
+	}
+	if n := testutil.CollectAndCount(m.duration); n != 1 {
+		t.Errorf("Want durations for one route, got %d", n)
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	app := web.NewApp(log.New(log.WithOutput(io.Discard)), MaxBodySize(16))
+	app.Post("", "/courses", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			return err
+		}
+		return web.Encode(ctx, w, struct{}{}, http.StatusCreated)
+	})
+
+	tests := []struct {
+		name string
+		body io.Reader
+		want int
+	}{
+		{"within limit", strings.NewReader(`{"title":"Go"}`), http.StatusCreated},
+		{"declared length", strings.NewReader(`{"title":"Advanced Go"}`), http.StatusRequestEntityTooLarge},
+		{"unknown length", io.MultiReader(strings.NewReader(`{"title":"Advanced Go"}`)), http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serve(app, http.MethodPost, "/courses", tt.body); w.Code != tt.want {
+				t.Errorf("Want status %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package mid
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/SteinerLabs/lms/backend/shared/web"
+)
+
+// Recover turns a panic in the handler into an error, which web.App reports
+// as a 500 response carrying the trace ID. The error includes the stack of
+// the panic for the log.
+func Recover() web.Middleware {
+	return func(handler web.Handler) web.Handler {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) (err error) {
+			defer func() {
+				if rec := recover(); rec != nil {
+					err = fmt.Errorf("panic: %v\n%s", rec, debug.Stack())
+				}
+			}()
+			return handler(ctx, w, r)
+		}
+	}
+}
@@ -2,12 +2,21 @@ package web
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 )
 
+// DefaultMaxBodySize is the largest request body Decode reads by default
+const DefaultMaxBodySize = 1 << 20
+
+// GetIntParam returns the integer query parameter key, or defaultValue if it
+// is missing or invalid. Use Bind to report invalid values instead.
 func GetIntParam(query url.Values, key string, defaultValue int) int {
 	if value := query.Get(key); value != "" {
 		if intValue, err := strconv.Atoi(value); err == nil {
@@ -17,13 +26,86 @@ func GetIntParam(query url.Values, key string, defaultValue int) int {
 	return defaultValue
 }
 
-func Decode[T any](r *http.Request, v *T) error {
-	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+// DecodeOption configures a single Decode
+type DecodeOption func(*decodeOptions)
+
+type decodeOptions struct {
+	maxBodySize   int64
+	unknownFields bool
+}
+
+// WithMaxBodySize sets the largest body Decode reads. It defaults to
+// DefaultMaxBodySize.
+func WithMaxBodySize(n int64) DecodeOption {
+	return func(o *decodeOptions) {
+		o.maxBodySize = n
+	}
+}
+
+// AllowUnknownFields accepts bodies with fields that v does not have
+func AllowUnknownFields() DecodeOption {
+	return func(o *decodeOptions) {
+		o.unknownFields = true
+	}
+}
+
+// Decode decodes the JSON body of r into v and validates it with Validate.
+// Requests that are not JSON fail with 415, bodies that are too large with
+// 413, malformed bodies and unknown fields with 400, and invalid fields with
+// FieldErrors.
+func Decode[T any](r *http.Request, v *T, opts ...DecodeOption) error {
+	o := decodeOptions{maxBodySize: DefaultMaxBodySize}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return NewError(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+	}
+	if r.ContentLength > o.maxBodySize {
+		return NewError(http.StatusRequestEntityTooLarge, "Request body too large")
+	}
+
+	body := http.MaxBytesReader(nil, r.Body, o.maxBodySize)
+	defer body.Close()
+
+	dec := json.NewDecoder(body)
+	if !o.unknownFields {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(v); err != nil {
+		return decodeError(err)
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return NewError(http.StatusBadRequest, "Request body must contain a single JSON value")
+	}
+
+	return Validate(v)
+}
+
+// decodeError maps an error of the JSON decoder to the error reported to the
+// client
+func decodeError(err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
 		return fmt.Errorf("failed to decode request body: %w", err)
+	case errors.Is(err, io.EOF):
+		return NewError(http.StatusBadRequest, "Request body is empty")
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return NewError(http.StatusBadRequest, "Request body is not valid JSON")
+	case errors.As(err, &typeErr):
+		return NewError(http.StatusBadRequest, "Request body has a field of the wrong type").
+			WithDetails(FieldError{Field: typeErr.Field, Reason: "must be a " + typeErr.Type.String()})
 	}
-	err := r.Body.Close()
-	if err != nil {
-		return err
+
+	// The decoder reports unknown fields only by message
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return NewError(http.StatusBadRequest, "Request body has an unknown field").
+			WithDetails(FieldError{Field: strings.Trim(field, `"`), Reason: "is not allowed"})
 	}
-	return nil
+	return NewError(http.StatusBadRequest, "Request body is invalid")
 }
@@ -0,0 +1,81 @@
+package web
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type enrollRequest struct {
+	CourseID string `json:"course_id" validate:"required,uuid"`
+	Note     string `json:"note" validate:"max=10"`
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        io.Reader
+		opts        []DecodeOption
+		wantStatus  int
+	}{
+		{"valid", "application/json", strings.NewReader(`{"course_id":"4bf92f35-77b3-4da6-a3ce-929d0e0e4736"}`), nil, 0},
+		{"charset", "application/json; charset=utf-8", strings.NewReader(`{"course_id":"4bf92f35-77b3-4da6-a3ce-929d0e0e4736"}`), nil, 0},
+		{"form", "application/x-www-form-urlencoded", strings.NewReader(`course_id=c1`), nil, http.StatusUnsupportedMediaType},
+		{"no content type", "", strings.NewReader(`{}`), nil, http.StatusUnsupportedMediaType},
+		{"empty", "application/json", strings.NewReader(``), nil, http.StatusBadRequest},
+		{"malformed", "application/json", strings.NewReader(`{"course_id":`), nil, http.StatusBadRequest},
+		{"wrong type", "application/json", strings.NewReader(`{"course_id":1}`), nil, http.StatusBadRequest},
+		{"unknown field", "application/json", strings.NewReader(`{"course_id":"4bf92f35-77b3-4da6-a3ce-929d0e0e4736","user_id":"u1"}`), nil, http.StatusBadRequest},
+		{"allowed unknown field", "application/json", strings.NewReader(`{"course_id":"4bf92f35-77b3-4da6-a3ce-929d0e0e4736","user_id":"u1"}`), []DecodeOption{AllowUnknownFields()}, 0},
+		{"trailing data", "application/json", strings.NewReader(`{"course_id":"4bf92f35-77b3-4da6-a3ce-929d0e0e4736"}{}`), nil, http.StatusBadRequest},
+		{"too large", "application/json", strings.NewReader(`{"course_id":"4bf92f35-77b3-4da6-a3ce-929d0e0e4736"}`), []DecodeOption{WithMaxBodySize(16)}, http.StatusRequestEntityTooLarge},
+		{"too large unknown length", "application/json", io.MultiReader(strings.NewReader(`{"course_id":"4bf92f35-77b3-4da6-a3ce-929d0e0e4736"}`)), []DecodeOption{WithMaxBodySize(16)}, http.StatusRequestEntityTooLarge},
+		{"invalid", "application/json", strings.NewReader(`{"course_id":"c1","note":"Please enroll me"}`), nil, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/enrollments", tt.body)
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+
+			var req enrollRequest
+			err := Decode(r, &req, tt.opts...)
+			if tt.wantStatus == 0 {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if req.CourseID != "4bf92f35-77b3-4da6-a3ce-929d0e0e4736" {
+					t.Errorf("Want the course ID decoded, got %+v", req)
+				}
+				return
+			}
+			if got := ErrorStatus(err); got != tt.wantStatus {
+				t.Errorf("Want status %d, got %d for %v", tt.wantStatus, got, err)
+			}
+		})
+	}
+}
+
+func TestDecode_FieldErrors(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/enrollments", strings.NewReader(`{"course_id":"c1","note":"Please enroll me"}`))
+	r.Header.Set("Content-Type", "application/json")
+
+	var req enrollRequest
+	var fieldErrs FieldErrors
+	if err := Decode(r, &req); !errors.As(err, &fieldErrs) {
+		t.Fatalf("Want FieldErrors, got %v", err)
+	}
+	want := FieldErrors{
+		{Field: "course_id", Reason: "must be a valid UUID"},
+		{Field: "note", Reason: "must be at most 10 characters"},
+	}
+	if len(fieldErrs) != len(want) || fieldErrs[0] != want[0] || fieldErrs[1] != want[1] {
+		t.Errorf("Want %v, got %v", want, fieldErrs)
+	}
+}
@@ -9,7 +9,7 @@ import (
 func Encode[T any](ctx context.Context, w http.ResponseWriter, data T, statusCode int) error {
 	_ = SetStatusCode(ctx, statusCode)
 
-	if statusCode == http.StatusNoContent || statusCode == http.StatusNotModified || data == nil {
+	if statusCode == http.StatusNoContent || statusCode == http.StatusNotModified || any(data) == nil {
 		w.WriteHeader(statusCode)
 		return nil
 	}
@@ -0,0 +1,206 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// Validator is implemented by request types with rules beyond the validate
+// struct tags. Validate returns FieldErrors for invalid fields; any other
+// error is reported as is.
+type Validator interface {
+	Validate() error
+}
+
+// Validate checks v against the validate tags of its fields and then calls
+// its Validate method, if it has one. Fields are named by their JSON name,
+// with nested fields joined by dots, and failures are collected into
+// FieldErrors. The tag holds comma separated rules:
+//
+//	required   the field is not its zero value
+//	min=n      strings have at least n characters, numbers are at least n,
+//	           slices and maps have at least n elements
+//	max=n      the upper bound of min
+//	oneof=a b  the field is one of the space separated values
+//	email      the field is an email address
+//	uuid       the field is a UUID
+//
+// Rules other than required are skipped for empty fields.
+func Validate(v any) error {
+	return validate(v, jsonName)
+}
+
+// validate is Validate with fields named by nameOf
+func validate(v any, nameOf func(reflect.StructField) string) error {
+	var errs FieldErrors
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() == reflect.Struct {
+		if err := validateStruct(rv, "", nameOf, &errs); err != nil {
+			return err
+		}
+	}
+
+	if validator, ok := v.(Validator); ok {
+		err := validator.Validate()
+		var fieldErrs FieldErrors
+		switch {
+		case errors.As(err, &fieldErrs):
+			errs = append(errs, fieldErrs...)
+		case err != nil:
+			return err
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validateStruct(rv reflect.Value, prefix string, nameOf func(reflect.StructField) string, errs *FieldErrors) error {
+	rt := rv.Type()
+	for i := range rt.NumField() {
+		field := rt.Field(i)
+		if !field.IsExported() && !(field.Anonymous && field.Type.Kind() == reflect.Struct) {
+			continue
+		}
+		name := nameOf(field)
+		if name == "-" {
+			continue
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		fv := rv.Field(i)
+
+		if tag := field.Tag.Get("validate"); tag != "" {
+			reason, err := validateField(fv, tag)
+			if err != nil {
+				return fmt.Errorf("invalid validate tag of field %s: %w", name, err)
+			}
+			if reason != "" {
+				*errs = append(*errs, FieldError{Field: name, Reason: reason})
+				continue
+			}
+		}
+
+		// Nested structs are validated with their parent
+		for fv.Kind() == reflect.Pointer && !fv.IsNil() {
+			fv = fv.Elem()
+		}
+		if fv.Kind() == reflect.Struct {
+			if field.Anonymous && nameOf(field) == field.Name {
+				name = prefix
+			}
+			if err := validateStruct(fv, name, nameOf, errs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateField returns why fv breaks the rules of tag, or "" if it is valid
+func validateField(fv reflect.Value, tag string) (string, error) {
+	rules := strings.Split(tag, ",")
+	if fv.IsZero() {
+		if slices.Contains(rules, "required") {
+			return "is required", nil
+		}
+		return "", nil
+	}
+	for fv.Kind() == reflect.Pointer {
+		fv = fv.Elem()
+	}
+
+	for _, rule := range rules {
+		name, arg, _ := strings.Cut(rule, "=")
+		var reason string
+		var err error
+		switch name {
+		case "required":
+		case "min":
+			reason, err = checkBound(fv, arg, true)
+		case "max":
+			reason, err = checkBound(fv, arg, false)
+		case "oneof":
+			options := strings.Fields(arg)
+			if !slices.Contains(options, fmt.Sprint(fv.Interface())) {
+				reason = "must be one of " + strings.Join(options, ", ")
+			}
+		case "email":
+			if fv.Kind() != reflect.String {
+				return "", fmt.Errorf("email requires a string")
+			}
+			if addr, err := mail.ParseAddress(fv.String()); err != nil || addr.Address != fv.String() {
+				reason = "must be a valid email address"
+			}
+		case "uuid":
+			if fv.Kind() != reflect.String {
+				return "", fmt.Errorf("uuid requires a string")
+			}
+			if _, err := uuid.Parse(fv.String()); err != nil {
+				reason = "must be a valid UUID"
+			}
+		default:
+			return "", fmt.Errorf("unknown rule %q", name)
+		}
+		if err != nil || reason != "" {
+			return reason, err
+		}
+	}
+	return "", nil
+}
+
+// checkBound checks the min or max rule with bound arg
+func checkBound(fv reflect.Value, arg string, min bool) (string, error) {
+	bound, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid bound %q", arg)
+	}
+
+	var n float64
+	var unit string
+	switch fv.Kind() {
+	case reflect.String:
+		n, unit = float64(utf8.RuneCountInString(fv.String())), " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		n, unit = float64(fv.Len()), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = float64(fv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = float64(fv.Uint())
+	case reflect.Float32, reflect.Float64:
+		n = fv.Float()
+	default:
+		return "", fmt.Errorf("bounds do not apply to %s", fv.Kind())
+	}
+
+	if min && n < bound {
+		return "must be at least " + arg + unit, nil
+	}
+	if !min && n > bound {
+		return "must be at most " + arg + unit, nil
+	}
+	return "", nil
+}
+
+// jsonName returns the name of field in JSON
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
@@ -0,0 +1,96 @@
+package web
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+type address struct {
+	City    string `json:"city" validate:"required"`
+	Country string `json:"country"`
+}
+
+type createCourse struct {
+	Title     string    `json:"title" validate:"required,min=3,max=20"`
+	Level     string    `json:"level" validate:"oneof=beginner advanced"`
+	Contact   string    `json:"contact" validate:"email"`
+	OwnerID   string    `json:"owner_id" validate:"required,uuid"`
+	Tags      []string  `json:"tags" validate:"max=2"`
+	Seats     *int      `json:"seats" validate:"min=1"`
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	Venue     *address  `json:"venue"`
+	Untracked string    `json:"-" validate:"required"`
+}
+
+func (c createCourse) Validate() error {
+	if !c.EndsAt.IsZero() && c.EndsAt.Before(c.StartsAt) {
+		return FieldErrors{{Field: "ends_at", Reason: "must be after starts_at"}}
+	}
+	return nil
+}
+
+func TestValidate(t *testing.T) {
+	zero := 0
+	start := time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		course createCourse
+		want   []string
+	}{
+		{
+			name:   "valid",
+			course: createCourse{Title: "Go basics", Level: "beginner", OwnerID: "4bf92f35-77b3-4da6-a3ce-929d0e0e4736", Venue: &address{City: "Berlin"}},
+		},
+		{
+			name:   "missing",
+			course: createCourse{},
+			want:   []string{"title: is required", "owner_id: is required"},
+		},
+		{
+			name: "invalid",
+			course: createCourse{
+				Title:    "Concurrency in Go for beginners",
+				Level:    "expert",
+				Contact:  "Ada <ada@example.com>",
+				OwnerID:  "u1",
+				Tags:     []string{"go", "concurrency", "beginner"},
+				Seats:    &zero,
+				StartsAt: start,
+				EndsAt:   start.Add(-time.Hour),
+				Venue:    &address{},
+			},
+			want: []string{
+				"title: must be at most 20 characters",
+				"level: must be one of beginner, advanced",
+				"contact: must be a valid email address",
+				"owner_id: must be a valid UUID",
+				"tags: must be at most 2 items",
+				"seats: must be at least 1",
+				"venue.city: is required",
+				"ends_at: must be after starts_at",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(&tt.course)
+			var got []string
+			var fieldErrs FieldErrors
+			if errors.As(err, &fieldErrs) {
+				for _, e := range fieldErrs {
+					got = append(got, e.Field+": "+e.Reason)
+				}
+			} else if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Want %q, got %q", tt.want, got)
+			}
+		})
+	}
+}